@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"simple-sync/src/models"
+)
+
+// runAclAdd adds an ACL rule
+func runAclAdd(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	args, err := parse(flags, args, 4)
+	if err != nil {
+		return err
+	}
+	rule := models.AclRule{Type: args[0], User: args[1], Item: args[2], Action: args[3]}
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.AddAclRule(rule); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Added rule: %s %s %s %s\n", rule.Type, rule.User, rule.Item, rule.Action)
+	return nil
+}
+
+// runAclList lists the current ACL rules
+func runAclList(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	var query models.AclRuleQuery
+	flags.StringVar(&query.User, "user", "", "only list rules whose user matches this pattern")
+	flags.StringVar(&query.Item, "item", "", "only list rules whose item matches this pattern")
+	flags.StringVar(&query.Action, "action", "", "only list rules whose action matches this pattern")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	rules, err := c.ListAclRules(query)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(a.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tUSER\tITEM\tACTION\tAUTHOR")
+	for _, rule := range rules {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", rule.Type, rule.User, rule.Item, rule.Action, rule.Author)
+	}
+	return w.Flush()
+}
+
+// runAclCheck explains whether a user may perform an action on an item
+func runAclCheck(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	args, err := parse(flags, args, 3)
+	if err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	decision, err := c.CheckAcl(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	outcome := "denied"
+	if decision.Allowed {
+		outcome = "allowed"
+	}
+	fmt.Fprintf(a.Stdout, "%s (%s)\n", outcome, decision.Reason)
+	if len(decision.Rules) > 0 {
+		w := tabwriter.NewWriter(a.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "\nTYPE\tUSER\tITEM\tACTION")
+		for _, rule := range decision.Rules {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rule.Type, rule.User, rule.Item, rule.Action)
+		}
+		return w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	apperrors "simple-sync/src/errors"
+	"simple-sync/src/models"
+	"simple-sync/src/services"
+)
+
+// runBootstrap creates the root user of a fresh database and prints its first
+// API key or a setup token for it
+func runBootstrap(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	useToken := flags.Bool("token", false, "print a setup token to exchange for the API key instead of the key itself")
+	description := flags.String("description", "Bootstrap", "description of the root API key")
+	ttl := flags.Duration("ttl", services.DefaultSetupTokenTTL, "how long the setup token is valid")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	store := a.OpenStorage()
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
+	authService := services.NewAuthService(store)
+
+	if *useToken {
+		setupToken, err := authService.BootstrapRootSetupToken(models.SetupTokenOptions{Long: true, TTL: *ttl})
+		if err != nil {
+			return bootstrapError(err)
+		}
+		fmt.Fprintf(a.Stdout, "Created the %s user. Exchange this setup token for its API key via POST /api/v1/user/exchangeToken before %s:\n\n%s\n",
+			services.RootUserId, setupToken.ExpiresAt.Format(time.RFC3339), setupToken.Token)
+		return nil
+	}
+
+	apiKey, plainKey, err := authService.BootstrapRootApiKey(*description)
+	if err != nil {
+		return bootstrapError(err)
+	}
+	fmt.Fprintf(a.Stdout, "Created the %s user with API key %s. Store the key securely, it is not shown again:\n\n%s\n",
+		services.RootUserId, apiKey.UUID, plainKey)
+	return nil
+}
+
+// bootstrapError describes why a bootstrap failed
+func bootstrapError(err error) error {
+	if errors.Is(err, apperrors.ErrAlreadyBootstrapped) {
+		return fmt.Errorf("bootstrap refused: %w", err)
+	}
+	return fmt.Errorf("bootstrap failed: %w", err)
+}
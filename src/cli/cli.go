@@ -0,0 +1,168 @@
+// Package cli implements the administrative commands of the simple-sync binary
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"simple-sync/src/storage"
+)
+
+// errUsage reports invalid arguments, after the usage has been printed
+var errUsage = errors.New("invalid arguments")
+
+// App runs CLI commands
+type App struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// OpenStorage opens the database for commands run without a server URL
+	OpenStorage func() storage.Storage
+	// PollInterval is how often `events tail` checks for new events
+	PollInterval time.Duration
+}
+
+// NewApp creates an app writing to the standard streams and opening the
+// configured SQLite database
+func NewApp() *App {
+	return &App{
+		Stdout:       os.Stdout,
+		Stderr:       os.Stderr,
+		OpenStorage:  storage.NewStorage,
+		PollInterval: time.Second,
+	}
+}
+
+// command is a CLI command, named by one or two words such as "user add"
+type command struct {
+	args    string // Synopsis of the positional arguments
+	summary string
+	run     func(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]command{
+	"bootstrap":     {"", "Create the .root user of a fresh database and print its first API key", runBootstrap},
+	"user add":      {"<id>", "Create a user", runUserAdd},
+	"user list":     {"", "List all users", runUserList},
+	"key issue":     {"<user>", "Issue a new API key for a user", runKeyIssue},
+	"key revoke":    {"<uuid>", "Revoke an API key", runKeyRevoke},
+	"acl add":       {"<allow|deny> <user> <item> <action>", "Add an ACL rule", runAclAdd},
+	"acl list":      {"", "List the current ACL rules", runAclList},
+	"acl check":     {"<user> <item> <action>", "Explain whether a user may perform an action", runAclCheck},
+	"events tail":   {"", "Print new events as they are added", runEventsTail},
+	"events export": {"", "Print all events as JSON lines", runEventsExport},
+}
+
+// Run executes the command given by args and returns the process exit code.
+// The context cancels long-running commands such as `events tail`.
+func (a *App) Run(ctx context.Context, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.usage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	name, cmd, ok := findCommand(args)
+	if !ok {
+		fmt.Fprintf(a.Stderr, "Unknown command: %s\n\n", strings.Join(args[:min(len(args), 2)], " "))
+		a.usage()
+		return 2
+	}
+	args = args[len(strings.Fields(name)):]
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(a.Stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(a.Stderr, "Usage: simple-sync %s [flags] %s\n\n%s\n", name, cmd.args, cmd.summary)
+		flags.PrintDefaults()
+	}
+
+	err := cmd.run(a, ctx, flags, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if errors.Is(err, errUsage) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(a.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// findCommand looks up the command named by the first one or two arguments
+func findCommand(args []string) (string, command, bool) {
+	if cmd, ok := commands[args[0]]; ok {
+		return args[0], cmd, true
+	}
+	if len(args) > 1 {
+		name := args[0] + " " + args[1]
+		if cmd, ok := commands[name]; ok {
+			return name, cmd, true
+		}
+	}
+	return "", command{}, false
+}
+
+// usage prints the list of commands
+func (a *App) usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(a.Stderr, "Usage: simple-sync <command> [flags] [arguments]\n\nCommands:\n")
+	fmt.Fprintf(a.Stderr, "  %-16s %s\n", "serve", "Run the server (default)")
+	for _, name := range names {
+		fmt.Fprintf(a.Stderr, "  %-16s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(a.Stderr, "\nCommands other than serve and bootstrap operate directly on the database, which\n"+
+		"requires the server to be stopped, or on a running server when given -url and an API key.\n"+
+		"Run `simple-sync <command> -h` for the flags of a command.\n")
+}
+
+// parse parses the flags of a command and checks the number of positional arguments
+func parse(flags *flag.FlagSet, args []string, count int) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsage
+	}
+	if flags.NArg() != count {
+		flags.Usage()
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+// clientFlags registers the flags selecting a server, and returns a function
+// connecting to it once the flags are parsed. Without a URL, the client
+// operates directly on the database.
+func (a *App) clientFlags(flags *flag.FlagSet) func() (client, error) {
+	url := flags.String("url", os.Getenv("SIMPLE_SYNC_URL"), "base URL of a running server, e.g. http://localhost:8080 (env SIMPLE_SYNC_URL)")
+	apiKey := flags.String("key", "", "API key for the server (env SIMPLE_SYNC_API_KEY)")
+	return func() (client, error) {
+		if *url == "" {
+			return newStorageClient(a.OpenStorage()), nil
+		}
+		key := *apiKey
+		if key == "" {
+			key = os.Getenv("SIMPLE_SYNC_API_KEY")
+		}
+		if key == "" {
+			return nil, errors.New("an API key is required with -url")
+		}
+		return newHTTPClient(*url, key), nil
+	}
+}
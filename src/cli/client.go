@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"simple-sync/src/models"
+)
+
+// client performs the operations of the CLI commands, either directly on the
+// database or through the HTTP API of a running server
+type client interface {
+	AddUser(id string) error
+	ListUsers() ([]models.User, error)
+	IssueKey(user, description string, scopes []string) (*issuedKey, error)
+	RevokeKey(uuid string) error
+	AddAclRule(rule models.AclRule) error
+	ListAclRules(query models.AclRuleQuery) ([]models.AclRuleRecord, error)
+	CheckAcl(user, item, action string) (*models.AclDecision, error)
+	QueryEvents(query models.EventQuery) (*models.EventPage, error)
+	Close() error
+}
+
+// issuedKey is a newly issued API key, in the format of the exchangeToken response
+type issuedKey struct {
+	UUID        string   `json:"keyUuid"`
+	ApiKey      string   `json:"apiKey"`
+	User        string   `json:"user"`
+	Description string   `json:"description"`
+	Scopes      []string `json:"scopes"`
+}
+
+// eventPageSize is the number of events requested per page
+const eventPageSize = 1000
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"time"
+
+	"simple-sync/src/models"
+)
+
+// eventFilterFlags registers the flags filtering events
+func eventFilterFlags(flags *flag.FlagSet) *models.EventQuery {
+	var query models.EventQuery
+	flags.StringVar(&query.User, "user", "", "only include events whose user matches this pattern")
+	flags.StringVar(&query.Item, "item", "", "only include events whose item matches this pattern")
+	flags.StringVar(&query.Action, "action", "", "only include events whose action matches this pattern")
+	return &query
+}
+
+// runEventsExport prints all events matching the filters as JSON lines
+func runEventsExport(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	query := eventFilterFlags(flags)
+	flags.StringVar(&query.After, "after", "", "only include events after this event UUID")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	encoder := json.NewEncoder(a.Stdout)
+	for {
+		page, err := c.QueryEvents(*query)
+		if err != nil {
+			return err
+		}
+		for _, event := range page.Events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		if !page.HasMore {
+			return nil
+		}
+		query.After = page.Next
+	}
+}
+
+// runEventsTail prints events matching the filters as JSON lines as they are
+// added, until the context is cancelled
+func runEventsTail(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	query := eventFilterFlags(flags)
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// Skip the existing events
+	for {
+		page, err := c.QueryEvents(*query)
+		if err != nil {
+			return err
+		}
+		query.After = page.Next
+		if !page.HasMore {
+			break
+		}
+	}
+
+	encoder := json.NewEncoder(a.Stdout)
+	ticker := time.NewTicker(a.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for {
+			page, err := c.QueryEvents(*query)
+			if err != nil {
+				return err
+			}
+			for _, event := range page.Events {
+				if err := encoder.Encode(event); err != nil {
+					return err
+				}
+			}
+			query.After = page.Next
+			if !page.HasMore {
+				break
+			}
+		}
+	}
+}
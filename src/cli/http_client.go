@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"simple-sync/src/models"
+)
+
+// httpClient operates on a running server through its HTTP API, with the
+// permissions of the given API key
+type httpClient struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+	userId  string // The key's user, looked up on first use
+}
+
+// newHTTPClient creates a client for the server at baseURL
+func newHTTPClient(baseURL, apiKey string) *httpClient {
+	return &httpClient{
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/api/v1",
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends a request and decodes the JSON response into result, if given
+func (c *httpClient) do(method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", c.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiError) != nil || apiError.Error == "" {
+			apiError.Error = resp.Status
+		}
+		return fmt.Errorf("%s %s: %s (HTTP %d)", method, path, apiError.Error, resp.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// user returns the user of the API key, which authors submitted events
+func (c *httpClient) user() (string, error) {
+	if c.userId == "" {
+		var me struct {
+			User string `json:"user"`
+		}
+		if err := c.do("GET", "/user/me", nil, &me); err != nil {
+			return "", err
+		}
+		c.userId = me.User
+	}
+	return c.userId, nil
+}
+
+// AddUser creates a user by submitting a .user.create event
+func (c *httpClient) AddUser(id string) error {
+	user, err := c.user()
+	if err != nil {
+		return err
+	}
+	event := models.NewEvent(user, ".user."+id, ".user.create", "{}")
+	return c.do("POST", "/events", []models.Event{*event}, nil)
+}
+
+// ListUsers returns all users
+func (c *httpClient) ListUsers() ([]models.User, error) {
+	var users []models.User
+	err := c.do("GET", "/users", nil, &users)
+	return users, err
+}
+
+// IssueKey issues an API key by generating and exchanging a setup token
+func (c *httpClient) IssueKey(user, description string, scopes []string) (*issuedKey, error) {
+	var token struct {
+		Token string `json:"token"`
+	}
+	err := c.do("POST", "/user/generateToken", map[string]any{"user": user, "scopes": scopes}, &token)
+	if err != nil {
+		return nil, err
+	}
+
+	var key issuedKey
+	err = c.do("POST", "/user/exchangeToken", map[string]string{"token": token.Token, "description": description}, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RevokeKey revokes an API key
+func (c *httpClient) RevokeKey(uuid string) error {
+	return c.do("DELETE", "/user/keys/"+url.PathEscape(uuid), nil, nil)
+}
+
+// AddAclRule adds an ACL rule
+func (c *httpClient) AddAclRule(rule models.AclRule) error {
+	return c.do("POST", "/acl", []models.AclRule{rule}, nil)
+}
+
+// ListAclRules returns the current ACL rules matching the query
+func (c *httpClient) ListAclRules(query models.AclRuleQuery) ([]models.AclRuleRecord, error) {
+	params := url.Values{}
+	for name, value := range map[string]string{"user": query.User, "item": query.Item, "action": query.Action} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	path := "/acl"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	var rules []models.AclRuleRecord
+	err := c.do("GET", path, nil, &rules)
+	return rules, err
+}
+
+// CheckAcl explains a permission check
+func (c *httpClient) CheckAcl(user, item, action string) (*models.AclDecision, error) {
+	var decision models.AclDecision
+	err := c.do("POST", "/acl/check", map[string]string{"user": user, "item": item, "action": action}, &decision)
+	if err != nil {
+		return nil, err
+	}
+	return &decision, nil
+}
+
+// QueryEvents returns one page of the events matching the query
+func (c *httpClient) QueryEvents(query models.EventQuery) (*models.EventPage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = eventPageSize
+	}
+	// The limit is always given, so the server responds with a page
+	params := url.Values{"limit": {strconv.Itoa(limit)}}
+	for name, value := range map[string]string{"after": query.After, "user": query.User, "item": query.Item, "action": query.Action} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	for name, value := range map[string]uint64{"afterSeq": query.AfterSeq, "from": query.From, "to": query.To} {
+		if value != 0 {
+			params.Set(name, strconv.FormatUint(value, 10))
+		}
+	}
+
+	var page models.EventPage
+	if err := c.do("GET", "/events?"+params.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Close releases idle connections
+func (c *httpClient) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"simple-sync/src/models"
+)
+
+// runKeyIssue issues a new API key for a user
+func runKeyIssue(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	description := flags.String("description", "CLI", "description of the API key")
+	scopes := flags.String("scopes", "", "comma separated scopes of the API key; empty for an unrestricted key")
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	var scopeList []string
+	if *scopes != "" {
+		scopeList = strings.Split(*scopes, ",")
+	}
+	if err := models.ValidateScopes(scopeList); err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	key, err := c.IssueKey(args[0], *description, scopeList)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Issued API key %s for user %s. Store the key securely, it is not shown again:\n\n%s\n", key.UUID, key.User, key.ApiKey)
+	return nil
+}
+
+// runKeyRevoke revokes an API key
+func runKeyRevoke(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.RevokeKey(args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Revoked API key %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"simple-sync/src/models"
+	"simple-sync/src/services"
+	"simple-sync/src/storage"
+)
+
+// storageClient operates directly on the database. Changes are made on behalf
+// of the root user and record the same internal events as the HTTP API.
+type storageClient struct {
+	storage     storage.Storage
+	authService *services.AuthService
+}
+
+// newStorageClient creates a client operating on the given storage
+func newStorageClient(store storage.Storage) *storageClient {
+	return &storageClient{
+		storage:     store,
+		authService: services.NewAuthService(store),
+	}
+}
+
+// AddUser creates a user through a .user.create event
+func (c *storageClient) AddUser(id string) error {
+	if id == "" {
+		return errors.New("user ID is required")
+	}
+	event := models.NewEvent(services.RootUserId, ".user."+id, ".user.create", "{}")
+	err := c.storage.AddEvents([]models.Event{*event})
+	if errors.Is(err, storage.ErrUserExists) {
+		return fmt.Errorf("user %s already exists", id)
+	}
+	return err
+}
+
+// ListUsers returns all users
+func (c *storageClient) ListUsers() ([]models.User, error) {
+	return c.storage.GetUsers()
+}
+
+// IssueKey issues an API key and records a .user.exchangeToken event, like
+// exchanging a setup token does. The user's setup tokens are left alone.
+func (c *storageClient) IssueKey(user, description string, scopes []string) (*issuedKey, error) {
+	if _, err := c.storage.GetUserById(user); err != nil {
+		return nil, err
+	}
+	apiKey, plainKey, err := c.authService.GenerateScopedApiKey(user, description, scopes)
+	if err != nil {
+		return nil, err
+	}
+	event := models.NewEvent(user, ".user."+user, ".user.exchangeToken", "{}")
+	if err := c.storage.AddEvents([]models.Event{*event}); err != nil {
+		return nil, err
+	}
+
+	return &issuedKey{
+		UUID:        apiKey.UUID,
+		ApiKey:      plainKey,
+		User:        apiKey.User,
+		Description: apiKey.Description,
+		Scopes:      apiKey.Scopes,
+	}, nil
+}
+
+// RevokeKey revokes an API key and records a .user.revokeKey event
+func (c *storageClient) RevokeKey(uuid string) error {
+	apiKey, err := c.storage.GetApiKeyByUuid(uuid)
+	if err != nil {
+		return err
+	}
+	if err := c.authService.RevokeApiKey(apiKey.UUID); err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(models.RevokeKeyPayload{KeyUuid: apiKey.UUID})
+	event := models.NewEvent(services.RootUserId, ".user."+apiKey.User, ".user.revokeKey", string(payload))
+	return c.storage.AddEvents([]models.Event{*event})
+}
+
+// AddAclRule adds an ACL rule through an .acl.addRule event
+func (c *storageClient) AddAclRule(rule models.AclRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	ruleJson, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	event := models.NewEvent(services.RootUserId, ".acl", ".acl.addRule", string(ruleJson))
+	return c.storage.AddEvents([]models.Event{*event})
+}
+
+// ListAclRules returns the current ACL rules matching the query
+func (c *storageClient) ListAclRules(query models.AclRuleQuery) ([]models.AclRuleRecord, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	records, err := c.storage.GetAclRuleRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []models.AclRuleRecord{}
+	for _, record := range records {
+		if query.Matches(&record.AclRule) {
+			rules = append(rules, record)
+		}
+	}
+	return rules, nil
+}
+
+// CheckAcl explains a permission check against the current ACL rules
+func (c *storageClient) CheckAcl(user, item, action string) (*models.AclDecision, error) {
+	aclService, err := services.NewAclService(c.storage)
+	if err != nil {
+		return nil, err
+	}
+	decision := aclService.Explain(user, item, action)
+	return &decision, nil
+}
+
+// QueryEvents returns one page of the events matching the query
+func (c *storageClient) QueryEvents(query models.EventQuery) (*models.EventPage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = eventPageSize
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	return storage.QueryEventPage(c.storage, query, limit)
+}
+
+// Close closes the database
+func (c *storageClient) Close() error {
+	if closer, ok := c.storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+)
+
+// runUserAdd creates a user
+func runUserAdd(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.AddUser(args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.Stdout, "Created user %s\n", args[0])
+	return nil
+}
+
+// runUserList lists all users
+func runUserList(a *App, ctx context.Context, flags *flag.FlagSet, args []string) error {
+	connect := a.clientFlags(flags)
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	users, err := c.ListUsers()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(a.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED")
+	for _, user := range users {
+		fmt.Fprintf(w, "%s\t%s\n", user.Id, user.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
@@ -9,6 +9,7 @@ var (
 	ErrInvalidApiKey       = errors.New("invalid API key")
 	ErrInvalidSetupToken   = errors.New("invalid setup token")
 	ErrSetupTokenExpired   = errors.New("setup token is expired or already used")
+	ErrApiKeyExpired       = errors.New("API key is expired")
 
 	// Validation errors
 	ErrInvalidTimestamp   = errors.New("invalid timestamp")
@@ -20,9 +21,20 @@ var (
 	ErrKeyHashRequired    = errors.New("key hash is required")
 	ErrCreatedAtRequired  = errors.New("created at time is required")
 	ErrTokenRequired      = errors.New("token is required")
-	ErrTokenInvalidFormat = errors.New("token must be in format XXXX-XXXX")
+	ErrTokenInvalidFormat = errors.New("token must be in format XXXX-XXXX or XXXX-XXXX-XXXX-XXXX-XXXX-XXXX")
 	ErrExpiresAtRequired  = errors.New("expires at time is required")
 	ErrIdRequired         = errors.New("id is required")
+	ErrInvalidCursor      = errors.New("cursor must be a valid event UUID")
+	ErrConflictingCursors = errors.New("only one of the UUID and sequence cursors can be given")
+	ErrInvalidSeqCursor   = errors.New("sequence cursor must be a non-negative integer")
+	ErrInvalidLimit       = errors.New("limit must be a positive integer")
+	ErrInvalidFilter      = errors.New("filter patterns can have at most one wildcard at the end")
+	ErrInvalidTimeRange   = errors.New("from must not be after to")
+	ErrInvalidUserItem    = errors.New("item must be in format .user.<id>")
+	ErrInvalidScope       = errors.New("scope must be one of events:read, events:write, acl:read, acl:write, user:admin")
+	ErrInvalidGracePeriod = errors.New("grace period must be between 0 and 30 days")
+	ErrInvalidTokenTTL    = errors.New("token TTL must be between 1 minute and 7 days")
+	ErrInvalidMaxUses     = errors.New("max uses must be between 1 and 100")
 
 	// ACL validation errors
 	ErrInvalidAclType            = errors.New("type must be either 'allow' or 'deny'")
@@ -37,5 +49,6 @@ var (
 	ErrAclActionInvalidWildcards = errors.New("action pattern can have at most one wildcard at the end")
 
 	// Business logic errors
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrAlreadyBootstrapped = errors.New("the root user already exists")
 )
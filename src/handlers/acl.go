@@ -2,13 +2,68 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"slices"
 
 	"simple-sync/src/models"
 
 	"github.com/gin-gonic/gin"
 )
 
+// GetAcl handles GET /api/v1/acl for listing the current ACL rules
+func (h *Handlers) GetAcl(c *gin.Context) {
+	// Get authenticated user from context
+	userId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if !requireScope(c, models.ScopeAclRead) {
+		return
+	}
+
+	if !h.aclService.CheckPermission(userIdStr, ".acl", ".acl.listRules") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Insufficient permissions",
+		})
+		return
+	}
+
+	query := models.AclRuleQuery{
+		User:   c.Query("user"),
+		Item:   c.Query("item"),
+		Action: c.Query("action"),
+	}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, err := h.storage.GetAclRuleRecords()
+	if err != nil {
+		log.Printf("GetAcl: failed to load ACL rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	rules := []models.AclRuleRecord{}
+	for _, record := range records {
+		if query.Matches(&record.AclRule) {
+			rules = append(rules, record)
+		}
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
 // PostAcl handles POST /api/v1/acl for submitting ACL rules
 func (h *Handlers) PostAcl(c *gin.Context) {
 	// Get authenticated user from context
@@ -24,6 +79,10 @@ func (h *Handlers) PostAcl(c *gin.Context) {
 		return
 	}
 
+	if !requireScope(c, models.ScopeAclWrite) {
+		return
+	}
+
 	if !h.aclService.CheckPermission(userIdStr, ".acl", ".acl.addRule") {
 		c.JSON(http.StatusForbidden, gin.H{
 			"error": "Insufficient permissions",
@@ -31,47 +90,166 @@ func (h *Handlers) PostAcl(c *gin.Context) {
 		return
 	}
 
-	var aclRules []models.AclRule
+	aclRules, ok := bindAclRules(c)
+	if !ok {
+		return
+	}
 
-	// Bind JSON request to ACL rules
-	if err := c.ShouldBindJSON(&aclRules); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+	// Convert ACL rules to regular events with current timestamp
+	var events []models.Event
+
+	for _, rule := range aclRules {
+		ruleJson, _ := json.Marshal(rule)
+
+		events = append(events, *models.NewEvent(
+			userId.(string),
+			".acl",
+			".acl.addRule",
+			string(ruleJson),
+		))
+	}
+
+	// Store the events
+	if err := h.addEvents(events); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	// Validate that at least one ACL rule is provided
-	if len(aclRules) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one ACL rule required"})
+	c.JSON(http.StatusOK, gin.H{"message": "ACL events submitted"})
+}
+
+// PostAclRemove handles POST /api/v1/acl/remove for removing ACL rules
+func (h *Handlers) PostAclRemove(c *gin.Context) {
+	// Get authenticated user from context
+	userId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 		return
 	}
 
-	// Validate each ACL rule
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if !requireScope(c, models.ScopeAclWrite) {
+		return
+	}
+
+	if !h.aclService.CheckPermission(userIdStr, ".acl", ".acl.removeRule") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Insufficient permissions",
+		})
+		return
+	}
+
+	aclRules, ok := bindAclRules(c)
+	if !ok {
+		return
+	}
+
+	// Only existing rules can be removed
+	currentRules, err := h.storage.GetAclRules()
+	if err != nil {
+		log.Printf("PostAclRemove: failed to load ACL rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
 	for _, rule := range aclRules {
-		if err := rule.Validate(); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !slices.Contains(currentRules, rule) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ACL rule not found"})
 			return
 		}
 	}
 
-	// Convert ACL rules to regular events with current timestamp
 	var events []models.Event
 
 	for _, rule := range aclRules {
 		ruleJson, _ := json.Marshal(rule)
 
 		events = append(events, *models.NewEvent(
-			userId.(string),
+			userIdStr,
 			".acl",
-			".acl.addRule",
+			".acl.removeRule",
 			string(ruleJson),
 		))
 	}
 
 	// Store the events
-	if err := h.storage.AddEvents(events); err != nil {
+	if err := h.addEvents(events); err != nil {
+		log.Printf("PostAclRemove: failed to save events: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "ACL events submitted"})
+	c.JSON(http.StatusOK, gin.H{"message": "ACL rules removed"})
+}
+
+// PostAclCheck handles POST /api/v1/acl/check for explaining an ACL decision
+func (h *Handlers) PostAclCheck(c *gin.Context) {
+	// Get authenticated user from context
+	userId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if !requireScope(c, models.ScopeAclRead) {
+		return
+	}
+
+	if !h.aclService.CheckPermission(userIdStr, ".acl", ".acl.checkPermission") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Insufficient permissions",
+		})
+		return
+	}
+
+	var request struct {
+		User   string `json:"user" binding:"required"`
+		Item   string `json:"item" binding:"required"`
+		Action string `json:"action" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user, item and action are required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.aclService.Explain(request.User, request.Item, request.Action))
+}
+
+// bindAclRules parses and validates a JSON array of ACL rules from the request
+// body, responding with an error if it is invalid
+func bindAclRules(c *gin.Context) ([]models.AclRule, bool) {
+	var aclRules []models.AclRule
+
+	// Bind JSON request to ACL rules
+	if err := c.ShouldBindJSON(&aclRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return nil, false
+	}
+
+	// Validate that at least one ACL rule is provided
+	if len(aclRules) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one ACL rule required"})
+		return nil, false
+	}
+
+	// Validate each ACL rule
+	for _, rule := range aclRules {
+		if err := rule.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+	}
+
+	return aclRules, true
 }
@@ -1,14 +1,39 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	apperrors "simple-sync/src/errors"
 	"simple-sync/src/models"
+	"simple-sync/src/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// defaultEventPageSize is used when a cursor is given without a limit
+	defaultEventPageSize = 1000
+	// maxEventPageSize caps the number of events returned in a single page
+	maxEventPageSize = 10000
+	// sinceHeader and sinceSeqHeader hold the UUID or sequence cursor of a
+	// client submitting events as an array, asking for the events after it
+	// instead of the full history
+	sinceHeader    = "X-Events-Since"
+	sinceSeqHeader = "X-Events-Since-Seq"
+	// eventUuidsHeader lists the UUIDs of the events submitted as an array, in
+	// order, when the server assigned any of them
+	eventUuidsHeader = "X-Event-Uuids"
+)
+
+// eventPageParams are the query parameters of GET /events that ask for a page
+// of events instead of the full history
+var eventPageParams = []string{"after", "afterSeq", "limit", "user", "item", "action", "from", "to"}
+
 // GetEvents handles GET /events
 func (h *Handlers) GetEvents(c *gin.Context) {
 	// Check authenticated user
@@ -17,6 +42,18 @@ func (h *Handlers) GetEvents(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 		return
 	}
+	if !requireScope(c, models.ScopeEventsRead) {
+		return
+	}
+
+	// Incremental sync or filtered query when the client provides any of their
+	// parameters. Other parameters, such as cache busters, are ignored.
+	for _, param := range eventPageParams {
+		if _, ok := c.GetQuery(param); ok {
+			h.getEventPage(c)
+			return
+		}
+	}
 
 	// Load all events
 	events, err := h.storage.LoadEvents()
@@ -26,7 +63,66 @@ func (h *Handlers) GetEvents(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, events)
+	c.JSON(http.StatusOK, eventsResponse(c, events))
+}
+
+// getEventPage responds with the filtered events after the client's cursor
+func (h *Handlers) getEventPage(c *gin.Context) {
+	limit := defaultEventPageSize
+	if limitStr, ok := c.GetQuery("limit"); ok {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": apperrors.ErrInvalidLimit.Error()})
+			return
+		}
+		limit = min(parsed, maxEventPageSize)
+	}
+
+	query := models.EventQuery{
+		After:  c.Query("after"),
+		User:   c.Query("user"),
+		Item:   c.Query("item"),
+		Action: c.Query("action"),
+	}
+	if value, ok := c.GetQuery("afterSeq"); ok {
+		afterSeq, err := parseSeqCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.AfterSeq = afterSeq
+	}
+	// Version 2 has millisecond timestamps
+	from, to := &query.From, &query.To
+	if apiVersion(c) >= 2 {
+		from, to = &query.FromMs, &query.ToMs
+	}
+	for _, bound := range []struct {
+		param  string
+		target *uint64
+	}{{"from", from}, {"to", to}} {
+		if value, ok := c.GetQuery(bound.param); ok {
+			parsed, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be a unix timestamp"})
+				return
+			}
+			*bound.target = parsed
+		}
+	}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := storage.QueryEventPage(h.storage, query, limit)
+	if err != nil {
+		log.Printf("GetEvents: failed to query events after %q: %v", query.After, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(c, page))
 }
 
 // PostEvents handles POST /events
@@ -37,52 +133,96 @@ func (h *Handlers) PostEvents(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 		return
 	}
+	if !requireScope(c, models.ScopeEventsWrite) {
+		return
+	}
+	scopes := c.GetStringSlice("scopes")
 
-	// Bind JSON array
-	var events []models.Event
-	if err := c.ShouldBindJSON(&events); err != nil {
+	body, err := c.GetRawData()
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
 		return
 	}
+	// An object wrapping the events asks for a result per event
+	if trimmed := bytes.TrimLeft(body, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		h.postEventBatch(c, userId.(string), scopes, body)
+		return
+	}
 
-	// Reject ACL events submitted via /events
-	for _, event := range events {
-		if event.Item == ".acl" && len(event.Action) > 4 && event.Action[:5] == ".acl." {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "ACL events must be submitted via dedicated /api/v1/acl endpoint", "eventUuid": event.UUID})
+	events, err := unmarshalEvents(c, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+	assigned := assignEventIds(events)
+	var delta *models.EventQuery
+	since, sinceSeq := c.Request.Header.Values(sinceHeader), c.Request.Header.Values(sinceSeqHeader)
+	if len(since) > 0 || len(sinceSeq) > 0 {
+		var cursor models.EventQuery
+		if len(since) > 0 {
+			cursor.After = since[0]
+		}
+		if len(sinceSeq) > 0 {
+			if cursor.AfterSeq, err = parseSeqCursor(sinceSeq[0]); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if delta = deltaQuery(c, cursor); delta == nil {
 			return
 		}
 	}
 
-	// Validate each event using the model validation
-	for _, event := range events {
-		if err := event.Validate(); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "eventUuid": event.UUID})
+	// Validate and check permissions for each event
+	for i := range events {
+		if rejection := h.checkEvent(userId.(string), scopes, &events[i]); rejection != nil {
+			c.JSON(rejection.status, gin.H{"error": rejection.message, "eventUuid": events[i].UUID})
 			return
 		}
+	}
 
-		// Validate that the event user matches the authenticated user
-		if event.User != "" && event.User != userId.(string) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot submit events for other users", "eventUuid": event.UUID})
+	// Add events. Events that were already stored are skipped, so retries succeed.
+	results, err := h.submitEvents(events, true)
+	if err != nil {
+		if message, ok := submitErrorMessage(err); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": message})
 			return
 		}
+		log.Printf("PostEvents: failed to save events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
 	}
 
-	// ACL permission checks for each event
-	for _, event := range events {
-		if !h.aclService.CheckPermission(userId.(string), event.Item, event.Action) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "eventUuid": event.UUID})
+	var page *models.EventPage
+	if delta != nil {
+		page, err = storage.QueryEventPage(h.storage, *delta, defaultEventPageSize)
+		if err != nil {
+			log.Printf("PostEvents: failed to query events after %q: %v", delta.After, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
-		if event.IsApiOnlyEvent() {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot add internal events through this endpoint", "eventUuid": event.UUID})
-			return
+	}
+
+	// Events assigned an ID by the server are answered like a wrapped batch,
+	// whose results give the UUIDs of the events in request order
+	if assigned {
+		uuids := make([]string, len(events))
+		for i := range events {
+			uuids[i] = events[i].UUID
 		}
+		c.Header(eventUuidsHeader, strings.Join(uuids, ","))
+		writeEventBatchResponse(c, results, page)
+		return
 	}
 
-	// Add events
-	if err := h.storage.AddEvents(events); err != nil {
-		log.Printf("PostEvents: failed to save events: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	if page != nil {
+		c.JSON(http.StatusOK, pageResponse(c, page))
+		return
+	}
+
+	// Keys without read access only get back the events they submitted
+	if !models.HasScope(scopes, models.ScopeEventsRead) {
+		c.JSON(http.StatusOK, eventsResponse(c, events))
 		return
 	}
 
@@ -94,5 +234,243 @@ func (h *Handlers) PostEvents(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, allEvents)
+	c.JSON(http.StatusOK, eventsResponse(c, allEvents))
+}
+
+// eventBatchResponse is the response to POST /events with a body of
+// {"events": [...]}. The page of events is only included when the request
+// gives a cursor.
+type eventBatchResponse struct {
+	Results []models.EventResult `json:"results"`
+	*models.EventPage
+}
+
+// eventBatchResponseV2 is an eventBatchResponse in the v2 representation
+type eventBatchResponseV2 struct {
+	Results []models.EventResult `json:"results"`
+	*models.EventPageV2
+}
+
+// postEventBatch handles POST /events with a body of {"events": [...]}. Each
+// event is stored or rejected on its own, and the response lists the result
+// of every event, followed by the events after the client's cursor if given.
+func (h *Handlers) postEventBatch(c *gin.Context, userId string, scopes []string, body []byte) {
+	var request struct {
+		Events   json.RawMessage `json:"events"`
+		Since    *string         `json:"since"` // Empty for all events
+		SinceSeq *uint64         `json:"sinceSeq"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+	var events []models.Event
+	var err error
+	if request.Events != nil {
+		if events, err = unmarshalEvents(c, request.Events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+			return
+		}
+		assignEventIds(events)
+	}
+	var delta *models.EventQuery
+	if request.Since != nil || request.SinceSeq != nil {
+		var cursor models.EventQuery
+		if request.Since != nil {
+			cursor.After = *request.Since
+		}
+		if request.SinceSeq != nil {
+			cursor.AfterSeq = *request.SinceSeq
+		}
+		if delta = deltaQuery(c, cursor); delta == nil {
+			return
+		}
+	}
+
+	results := make([]models.EventResult, len(events))
+	var submitted []models.Event
+	var submittedIndexes []int
+	for i := range events {
+		event := &events[i]
+		if rejection := h.checkEvent(userId, scopes, event); rejection != nil {
+			results[i] = models.EventResult{UUID: event.UUID, Status: models.EventStatusRejected, Error: rejection.message}
+			continue
+		}
+		submitted = append(submitted, *event)
+		submittedIndexes = append(submittedIndexes, i)
+	}
+
+	if len(submitted) > 0 {
+		submittedResults, err := h.submitEvents(submitted, false)
+		if err != nil {
+			log.Printf("PostEvents: failed to save events: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		for i, result := range submittedResults {
+			results[submittedIndexes[i]] = result
+		}
+	}
+
+	var page *models.EventPage
+	if delta != nil {
+		page, err = storage.QueryEventPage(h.storage, *delta, defaultEventPageSize)
+		if err != nil {
+			log.Printf("PostEvents: failed to query events after %q: %v", delta.After, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	}
+	writeEventBatchResponse(c, results, page)
+}
+
+// writeEventBatchResponse responds with the results of submitted events and
+// the page of events after the client's cursor, if any, in the representation
+// of the request's API version
+func writeEventBatchResponse(c *gin.Context, results []models.EventResult, page *models.EventPage) {
+	if apiVersion(c) >= 2 {
+		response := eventBatchResponseV2{Results: results}
+		if page != nil {
+			pageV2 := page.V2()
+			response.EventPageV2 = &pageV2
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	c.JSON(http.StatusOK, eventBatchResponse{Results: results, EventPage: page})
+}
+
+// deltaQuery builds the query for the events after the cursor given with
+// submitted events, which are returned in pages like GET /events. Responds
+// with an error and returns nil if the cursor cannot be used.
+func deltaQuery(c *gin.Context, cursor models.EventQuery) *models.EventQuery {
+	if !requireScope(c, models.ScopeEventsRead) {
+		return nil
+	}
+	query := &models.EventQuery{After: cursor.After, AfterSeq: cursor.AfterSeq}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil
+	}
+	return query
+}
+
+// apiVersion returns the API version of the request's route, which selects the
+// representation of events
+func apiVersion(c *gin.Context) int {
+	if version := c.GetInt("api_version"); version != 0 {
+		return version
+	}
+	return 1
+}
+
+// unmarshalEvents decodes submitted events in the representation of the
+// request's API version
+func unmarshalEvents(c *gin.Context, data []byte) ([]models.Event, error) {
+	if apiVersion(c) < 2 {
+		var events []models.Event
+		err := json.Unmarshal(data, &events)
+		return events, err
+	}
+
+	var eventsV2 []models.EventV2
+	if err := json.Unmarshal(data, &eventsV2); err != nil {
+		return nil, err
+	}
+	events := make([]models.Event, len(eventsV2))
+	for i := range eventsV2 {
+		events[i] = eventsV2[i].Event()
+	}
+	return events, nil
+}
+
+// assignEventIds gives events submitted without a UUID and timestamp a new
+// UUID and the current time, for clients that cannot generate them. Returns
+// whether any event was assigned an ID.
+func assignEventIds(events []models.Event) bool {
+	assigned := false
+	for i := range events {
+		event := &events[i]
+		if event.UUID != "" || event.Timestamp != 0 {
+			continue
+		}
+		newEvent := models.NewEvent(event.User, event.Item, event.Action, event.Payload)
+		event.UUID = newEvent.UUID
+		event.Timestamp = newEvent.Timestamp
+		event.TimestampMs = newEvent.TimestampMs
+		assigned = true
+	}
+	return assigned
+}
+
+// eventsResponse returns events in the representation of the request's API version
+func eventsResponse(c *gin.Context, events []models.Event) any {
+	if apiVersion(c) >= 2 {
+		return models.EventsV2(events)
+	}
+	return events
+}
+
+// pageResponse returns a page of events in the representation of the
+// request's API version
+func pageResponse(c *gin.Context, page *models.EventPage) any {
+	if apiVersion(c) >= 2 {
+		return page.V2()
+	}
+	return page
+}
+
+// parseSeqCursor parses a sequence number given as a cursor
+func parseSeqCursor(value string) (uint64, error) {
+	seq, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, apperrors.ErrInvalidSeqCursor
+	}
+	return seq, nil
+}
+
+// eventRejection describes why a submitted event was not accepted
+type eventRejection struct {
+	status  int
+	message string
+}
+
+// checkEvent validates an event submitted by a client and checks that the
+// user and API key scopes allow adding it. Returns nil if the event can be stored.
+func (h *Handlers) checkEvent(userId string, scopes []string, event *models.Event) *eventRejection {
+	// Reject ACL events submitted via /events
+	if event.Item == ".acl" && len(event.Action) > 4 && event.Action[:5] == ".acl." {
+		return &eventRejection{http.StatusBadRequest, "ACL events must be submitted via dedicated /api/v1/acl endpoint"}
+	}
+
+	// Validate the event using the model validation
+	if err := event.Validate(); err != nil {
+		return &eventRejection{http.StatusBadRequest, err.Error()}
+	}
+
+	// Validate that the event user matches the authenticated user
+	if event.User != "" && event.User != userId {
+		return &eventRejection{http.StatusForbidden, "Cannot submit events for other users"}
+	}
+
+	// ACL permission check
+	if !h.aclService.CheckPermission(userId, event.Item, event.Action) {
+		return &eventRejection{http.StatusForbidden, "Insufficient permissions"}
+	}
+	if event.IsApiOnlyEvent() {
+		return &eventRejection{http.StatusForbidden, "Cannot add internal events through this endpoint"}
+	}
+
+	// Users can only be created once, by keys allowed to administer users
+	if event.IsUserCreateEvent() {
+		if !models.HasScope(scopes, models.ScopeUserAdmin) {
+			return &eventRejection{http.StatusForbidden, "API key does not have the " + models.ScopeUserAdmin + " scope"}
+		}
+		// Existing users are rejected when storing, which tells retries apart
+		if _, err := event.ToUser(); err != nil {
+			return &eventRejection{http.StatusBadRequest, err.Error()}
+		}
+	}
+
+	return nil
 }
@@ -1,19 +1,29 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"net/http"
+	apperrors "simple-sync/src/errors"
 	"simple-sync/src/models"
 	"simple-sync/src/services"
 	"simple-sync/src/storage"
+	"sync"
 	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 // Handlers contains the HTTP handlers for the API
 type Handlers struct {
-	storage     storage.Storage
-	authService *services.AuthService
-	aclService  *services.AclService
-	startTime   time.Time
-	version     string
+	storage          storage.Storage
+	authService      *services.AuthService
+	aclService       *services.AclService
+	broadcaster      *services.EventBroadcaster
+	writeMutex       sync.Mutex                 // Held while storing and publishing events
+	exchangeThrottle *services.ExchangeThrottle // Limits guessing of setup tokens
+	startTime        time.Time
+	version          string
 }
 
 // NewHandlers creates a new handlers instance
@@ -24,12 +34,16 @@ func NewHandlers(storage storage.Storage, version string) (*Handlers, error) {
 		return nil, err
 	}
 
+	exchangeThrottle := services.NewExchangeThrottle(services.DefaultClientThrottleLimits, services.DefaultGlobalThrottleLimits)
+
 	return &Handlers{
-		storage:     storage,
-		authService: authService,
-		aclService:  aclService,
-		startTime:   time.Now(),
-		version:     version,
+		storage:          storage,
+		authService:      authService,
+		aclService:       aclService,
+		broadcaster:      services.NewEventBroadcaster(),
+		exchangeThrottle: exchangeThrottle,
+		startTime:        time.Now(),
+		version:          version,
 	}, nil
 }
 
@@ -58,3 +72,121 @@ func (h *Handlers) AuthService() *services.AuthService {
 func (h *Handlers) AclService() *services.AclService {
 	return h.aclService
 }
+
+// Broadcaster returns the event broadcaster instance
+func (h *Handlers) Broadcaster() *services.EventBroadcaster {
+	return h.broadcaster
+}
+
+// requireScope checks that the API key used for the request grants scope,
+// responding with 403 Forbidden if it does not
+func requireScope(c *gin.Context, scope string) bool {
+	if !models.HasScope(c.GetStringSlice("scopes"), scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key does not have the " + scope + " scope"})
+		return false
+	}
+	return true
+}
+
+// requireGrantableScopes checks that the requested scopes are valid and may
+// be handed out by the API key used for the request, responding with 400 Bad
+// Request or 403 Forbidden if not. Scoped keys can only hand out keys and
+// tokens with a subset of their own scopes.
+func requireGrantableScopes(c *gin.Context, requested []string) bool {
+	if err := models.ValidateScopes(requested); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if !models.ScopesSubset(requested, c.GetStringSlice("scopes")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot grant scopes the API key does not have"})
+		return false
+	}
+	return true
+}
+
+// setupTokenTTL converts a setup token TTL in seconds to a Duration, or
+// responds with 400 Bad Request if it is out of range. The seconds are checked
+// before converting, as large values overflow a Duration.
+func setupTokenTTL(c *gin.Context, seconds int64) (time.Duration, bool) {
+	if seconds < 0 || seconds > int64(services.MaxSetupTokenTTL/time.Second) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": apperrors.ErrInvalidTokenTTL.Error()})
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// addEvents stores events, applies any new ACL rules and publishes the
+// events to stream subscribers.
+// All handlers that write events must go through here. Writes are serialised
+// so that subscribers receive events in the order they were stored.
+func (h *Handlers) addEvents(events []models.Event) error {
+	h.writeMutex.Lock()
+	defer h.writeMutex.Unlock()
+
+	if err := h.storage.AddEvents(events); err != nil {
+		return err
+	}
+	h.eventsStored(events)
+	return nil
+}
+
+// submitErrorMessages are the API messages of the storage errors rejecting a
+// submitted event
+var submitErrorMessages = map[error]string{
+	storage.ErrUserExists:   "User already exists",
+	storage.ErrDuplicateKey: "Event UUID already exists with different content",
+}
+
+// submitErrorMessage returns the API message of a storage error rejecting a
+// submitted event
+func submitErrorMessage(err error) (string, bool) {
+	for target, message := range submitErrorMessages {
+		if errors.Is(err, target) {
+			return message, true
+		}
+	}
+	return "", false
+}
+
+// submitEvents stores events submitted by a client like addEvents, skipping
+// events that were already stored. Only the newly stored events are applied
+// and published.
+func (h *Handlers) submitEvents(events []models.Event, atomic bool) ([]models.EventResult, error) {
+	h.writeMutex.Lock()
+	defer h.writeMutex.Unlock()
+
+	results, err := h.storage.SubmitEvents(events, atomic)
+	if err != nil {
+		return nil, err
+	}
+	var stored []models.Event
+	for i, result := range results {
+		if result.Status == models.EventStatusAccepted {
+			stored = append(stored, events[i])
+		}
+		if message, ok := submitErrorMessage(result.Err); ok {
+			results[i].Error = message
+		}
+	}
+	if len(stored) > 0 {
+		h.eventsStored(stored)
+	}
+	return results, nil
+}
+
+// eventsStored applies and publishes events that were just stored, for writes
+// that store events other than through addEvents. Must be called with the
+// write mutex held since storing the events.
+func (h *Handlers) eventsStored(events []models.Event) {
+	// Apply new ACL rules before anyone can observe the events
+	for _, event := range events {
+		if event.IsAclEvent() {
+			if err := h.aclService.Refresh(); err != nil {
+				log.Printf("eventsStored: failed to refresh ACL rules: %v", err)
+			}
+			break
+		}
+	}
+
+	h.broadcaster.Publish(events)
+}
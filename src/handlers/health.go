@@ -10,7 +10,7 @@ import (
 )
 
 // GetHealth handles GET /health
-func (h Handlers) GetHealth(c *gin.Context) {
+func (h *Handlers) GetHealth(c *gin.Context) {
 	uptime := int64(time.Since(h.startTime).Seconds())
 
 	healthResponse := models.NewHealthCheckResponse("healthy", h.version, uptime)
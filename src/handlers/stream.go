@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"simple-sync/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// streamReplayPageSize is the number of events loaded per query while replaying
+	streamReplayPageSize = 1000
+	// streamHeartbeatInterval keeps idle connections open through proxies
+	streamHeartbeatInterval = 30 * time.Second
+	// streamMaxEventsPerWrite limits how many live events are written before flushing
+	streamMaxEventsPerWrite = 100
+)
+
+// GetEventsStream handles GET /events/stream
+func (h *Handlers) GetEventsStream(c *gin.Context) {
+	// Check authenticated user
+	_, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	if !requireScope(c, models.ScopeEventsRead) {
+		return
+	}
+
+	// Resume from the last event the client received, if any. A reconnecting
+	// EventSource sends it in Last-Event-ID along with the original URL, so
+	// the header takes precedence over the cursors in the query.
+	query := models.EventQuery{After: c.GetHeader("Last-Event-ID"), Limit: streamReplayPageSize}
+	resume := query.After != ""
+	if !resume {
+		query.After = c.Query("after")
+		resume = query.After != ""
+		if value, ok := c.GetQuery("afterSeq"); ok {
+			afterSeq, err := parseSeqCursor(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			query.AfterSeq = afterSeq
+			resume = true
+		}
+	}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Subscribe before replaying so no event committed in between is missed
+	subscription := h.subscribeEvents()
+	defer subscription.close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	// Replay stored events after the cursor
+	if resume {
+		err := subscription.replay(query, func(page []models.Event) error {
+			return writeStreamEvents(c, page)
+		})
+		if err != nil {
+			log.Printf("GetEventsStream: failed to replay events after %q: %v", query.After, err)
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case event, ok := <-subscription.events:
+			batch, ok := subscription.batch(event, ok, streamMaxEventsPerWrite)
+			if err := writeStreamEvents(c, batch); err != nil {
+				return
+			}
+			if !ok {
+				// Dropped for falling behind; the client resumes with Last-Event-ID
+				return
+			}
+		}
+	}
+}
+
+// eventSubscription delivers live events to a streaming client after the
+// stored events it replayed, skipping live events that were already replayed
+type eventSubscription struct {
+	h        *Handlers
+	events   chan models.Event
+	replayed map[string]struct{}
+	pending  int // Live events received while replaying, which may have been replayed
+
+	// ignore reports whether a live event should not be sent to the client
+	ignore func(uuid string) bool
+}
+
+// subscribeEvents subscribes to live events
+func (h *Handlers) subscribeEvents() *eventSubscription {
+	return &eventSubscription{h: h, events: h.broadcaster.Subscribe()}
+}
+
+// close unsubscribes from live events
+func (s *eventSubscription) close() {
+	s.h.broadcaster.Unsubscribe(s.events)
+}
+
+// replay loads the stored events matching query page by page and passes each
+// page to send. The UUIDs of the replayed events are kept so that live events
+// received while replaying can be deduplicated.
+func (s *eventSubscription) replay(query models.EventQuery, send func([]models.Event) error) error {
+	s.replayed = make(map[string]struct{})
+	for {
+		page, err := s.h.storage.QueryEvents(query)
+		if err != nil {
+			return err
+		}
+		if len(page) > 0 {
+			if err := send(page); err != nil {
+				return err
+			}
+		}
+		for _, event := range page {
+			s.replayed[event.UUID] = struct{}{}
+		}
+		if query.Limit == 0 || len(page) < query.Limit {
+			break
+		}
+		query.After, query.AfterSeq = "", page[len(page)-1].Seq
+	}
+
+	// Events published while replaying may already have been sent
+	s.pending = len(s.events)
+	return nil
+}
+
+// batch collects a live event received from the subscription together with
+// the events already waiting behind it, up to max, leaving out events that
+// were replayed or are ignored. ok is false once the subscription has been
+// dropped for falling behind.
+func (s *eventSubscription) batch(event models.Event, ok bool, max int) ([]models.Event, bool) {
+	var batch []models.Event
+	for ok {
+		if !s.skip(event) {
+			batch = append(batch, event)
+		}
+		if len(batch) >= max || len(s.events) == 0 {
+			break
+		}
+		event, ok = <-s.events
+	}
+	return batch, ok
+}
+
+// skip reports whether a live event was already replayed or is ignored
+func (s *eventSubscription) skip(event models.Event) bool {
+	if s.pending > 0 {
+		s.pending--
+		if _, sent := s.replayed[event.UUID]; sent {
+			return true
+		}
+	}
+	return s.ignore != nil && s.ignore(event.UUID)
+}
+
+// writeStreamEvents writes events in Server-Sent Events format, in the
+// representation of the request's API version, and flushes them
+func writeStreamEvents(c *gin.Context, events []models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for _, event := range events {
+		if err := writeStreamEvent(c.Writer, event, apiVersion(c)); err != nil {
+			return err
+		}
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// writeStreamEvent writes a single event in Server-Sent Events format, in the
+// representation of the given API version
+func writeStreamEvent(w io.Writer, event models.Event, version int) error {
+	var representation any = event
+	if version >= 2 {
+		representation = event.V2()
+	}
+	data, err := json.Marshal(representation)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: event\ndata: %s\n\n", event.UUID, data)
+	return err
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"simple-sync/src/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// syncHandshakeTimeout is how long the server waits for the hello frame
+	syncHandshakeTimeout = 10 * time.Second
+	// syncPingInterval is how often the server pings an idle connection
+	syncPingInterval = 30 * time.Second
+	// syncPongTimeout closes connections that stop answering pings
+	syncPongTimeout = 2 * syncPingInterval
+	// syncWriteTimeout bounds how long a single frame write may take
+	syncWriteTimeout = 10 * time.Second
+	// syncMaxFrameSize limits the size of a single client frame
+	syncMaxFrameSize = 10 << 20
+	// syncMaxEventsPerFrame limits how many live events are batched into one frame
+	syncMaxEventsPerFrame = 100
+)
+
+var syncUpgrader = websocket.Upgrader{}
+
+// syncSession holds the state of a single WebSocket sync connection
+type syncSession struct {
+	h        *Handlers
+	conn     *websocket.Conn
+	userId   string
+	scopes   []string
+	outbound chan models.SyncFrame // Frames queued by the reader for the writer
+	done     chan struct{}         // Closed when the reader stops
+	stopped  chan struct{}         // Closed when the writer stops
+
+	// UUIDs pushed by this client, so they are acked instead of echoed back
+	pushed      map[string]struct{}
+	pushedMutex sync.Mutex
+}
+
+// GetSync handles GET /sync
+func (h *Handlers) GetSync(c *gin.Context) {
+	// Get authenticated user from context
+	userId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	if !requireScope(c, models.ScopeEventsRead) {
+		return
+	}
+
+	conn, err := syncUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already responded with an HTTP error
+		log.Printf("GetSync: failed to upgrade connection: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(syncMaxFrameSize)
+
+	session := &syncSession{
+		h:        h,
+		conn:     conn,
+		userId:   userId.(string),
+		scopes:   c.GetStringSlice("scopes"),
+		outbound: make(chan models.SyncFrame, 64),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		pushed:   make(map[string]struct{}),
+	}
+	session.run()
+	close(session.stopped)
+}
+
+// run performs the handshake, replays missed events and then relays frames
+// in both directions until the connection closes
+func (s *syncSession) run() {
+	// Handshake
+	s.conn.SetReadDeadline(time.Now().Add(syncHandshakeTimeout))
+	var hello models.SyncFrame
+	if err := s.conn.ReadJSON(&hello); err != nil {
+		return
+	}
+	if hello.Version != models.SyncProtocolVersion {
+		s.fail("unsupported protocol version")
+		return
+	}
+	if hello.Type != models.SyncFrameHello {
+		s.fail("expected hello frame")
+		return
+	}
+	query := models.EventQuery{After: hello.LastEventId, AfterSeq: hello.LastSeq, Limit: streamReplayPageSize}
+	if err := query.Validate(); err != nil {
+		s.fail(err.Error())
+		return
+	}
+
+	// Subscribe before replaying so no event committed in between is missed.
+	// Events pushed by this client are acked instead of echoed back.
+	subscription := s.h.subscribeEvents()
+	defer subscription.close()
+	subscription.ignore = s.wasPushed
+
+	welcome := models.NewSyncFrame(models.SyncFrameWelcome)
+	welcome.User = s.userId
+	if err := s.write(welcome); err != nil {
+		return
+	}
+
+	// Replay every stored event the client has not seen
+	err := subscription.replay(query, func(page []models.Event) error {
+		frame := models.NewSyncFrame(models.SyncFrameEvents)
+		frame.Events = page
+		return s.write(frame)
+	})
+	if err != nil {
+		log.Printf("GetSync: failed to replay events after %q: %v", hello.LastEventId, err)
+		return
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(syncPongTimeout))
+	s.conn.SetPongHandler(func(string) error {
+		s.conn.SetReadDeadline(time.Now().Add(syncPongTimeout))
+		return nil
+	})
+	go s.readLoop()
+
+	ping := time.NewTicker(syncPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			// Flush any final frames queued by the reader
+			for {
+				select {
+				case frame := <-s.outbound:
+					s.write(frame)
+				default:
+					return
+				}
+			}
+		case frame := <-s.outbound:
+			if err := s.write(frame); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(syncWriteTimeout)); err != nil {
+				return
+			}
+		case event, ok := <-subscription.events:
+			// Batch any other events that are already waiting
+			batch, ok := subscription.batch(event, ok, syncMaxEventsPerFrame)
+			if len(batch) > 0 {
+				frame := models.NewSyncFrame(models.SyncFrameEvents)
+				frame.Events = batch
+				if err := s.write(frame); err != nil {
+					return
+				}
+			}
+			if !ok {
+				// Dropped for falling behind; the client resumes with its last seen UUID
+				s.fail("connection fell behind, reconnect to resume")
+				return
+			}
+		}
+	}
+}
+
+// readLoop reads client frames until the connection fails
+func (s *syncSession) readLoop() {
+	defer close(s.done)
+
+	for {
+		var frame models.SyncFrame
+		if err := s.conn.ReadJSON(&frame); err != nil {
+			var syntaxError *json.SyntaxError
+			var typeError *json.UnmarshalTypeError
+			if errors.As(err, &syntaxError) || errors.As(err, &typeError) {
+				s.queueError("invalid frame")
+			}
+			return
+		}
+
+		if frame.Version != models.SyncProtocolVersion {
+			s.queueError("unsupported protocol version")
+			return
+		}
+
+		switch frame.Type {
+		case models.SyncFramePush:
+			s.handlePush(frame)
+		default:
+			s.queueError("unexpected frame type " + frame.Type)
+			return
+		}
+	}
+}
+
+// handlePush validates and stores a batch of pushed events, acknowledging or
+// rejecting each event individually
+func (s *syncSession) handlePush(push models.SyncFrame) {
+	if !models.HasScope(s.scopes, models.ScopeEventsWrite) {
+		for _, event := range push.Events {
+			s.queueResult(push.Id, event.UUID, "API key does not have the "+models.ScopeEventsWrite+" scope")
+		}
+		return
+	}
+
+	var accepted []models.Event
+	for i := range push.Events {
+		event := &push.Events[i]
+		if rejection := s.h.checkEvent(s.userId, s.scopes, event); rejection != nil {
+			s.queueResult(push.Id, event.UUID, rejection.message)
+			continue
+		}
+		accepted = append(accepted, *event)
+	}
+	if len(accepted) == 0 {
+		return
+	}
+
+	// Mark before storing, since the broadcaster publishes synchronously
+	s.markPushed(accepted, true)
+	results, err := s.h.submitEvents(accepted, false)
+	if err != nil {
+		log.Printf("GetSync: failed to save events: %v", err)
+		s.markPushed(accepted, false)
+		for _, event := range accepted {
+			s.queueResult(push.Id, event.UUID, "Internal server error")
+		}
+		return
+	}
+
+	for i, result := range results {
+		// Duplicates were stored before and are not published again
+		if result.Status != models.EventStatusAccepted {
+			s.markPushed(accepted[i:i+1], false)
+		}
+		s.queueResult(push.Id, result.UUID, result.Error)
+	}
+}
+
+// markPushed records or forgets UUIDs pushed by this client
+func (s *syncSession) markPushed(events []models.Event, pushed bool) {
+	s.pushedMutex.Lock()
+	defer s.pushedMutex.Unlock()
+	for _, event := range events {
+		if pushed {
+			s.pushed[event.UUID] = struct{}{}
+		} else {
+			delete(s.pushed, event.UUID)
+		}
+	}
+}
+
+// wasPushed reports whether this client pushed the event, forgetting it once echoed
+func (s *syncSession) wasPushed(uuid string) bool {
+	s.pushedMutex.Lock()
+	defer s.pushedMutex.Unlock()
+	if _, exists := s.pushed[uuid]; exists {
+		delete(s.pushed, uuid)
+		return true
+	}
+	return false
+}
+
+// queueResult queues an ack frame, or a reject frame if message is not empty
+func (s *syncSession) queueResult(id, eventUuid, message string) {
+	frame := models.NewSyncFrame(models.SyncFrameAck)
+	if message != "" {
+		frame = models.NewSyncFrame(models.SyncFrameReject)
+		frame.Error = message
+	}
+	frame.Id = id
+	frame.EventUuid = eventUuid
+	s.queue(frame)
+}
+
+// queueError queues an error frame from the reader
+func (s *syncSession) queueError(message string) {
+	frame := models.NewSyncFrame(models.SyncFrameError)
+	frame.Error = message
+	s.queue(frame)
+}
+
+// queue hands a frame from the reader to the writer, unless the writer has stopped
+func (s *syncSession) queue(frame models.SyncFrame) {
+	select {
+	case s.outbound <- frame:
+	case <-s.stopped:
+	}
+}
+
+// fail sends an error frame and closes the connection
+func (s *syncSession) fail(message string) {
+	frame := models.NewSyncFrame(models.SyncFrameError)
+	frame.Error = message
+	if err := s.write(frame); err != nil {
+		return
+	}
+	s.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, message),
+		time.Now().Add(syncWriteTimeout))
+}
+
+// write sends a frame to the client. Only the session's run loop may write.
+func (s *syncSession) write(frame models.SyncFrame) error {
+	s.conn.SetWriteDeadline(time.Now().Add(syncWriteTimeout))
+	return s.conn.WriteJSON(frame)
+}
@@ -1,9 +1,17 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	apperrors "simple-sync/src/errors"
 	"simple-sync/src/models"
+	"simple-sync/src/services"
+	"simple-sync/src/storage"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,9 +30,16 @@ func (h *Handlers) PostUserResetKey(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
 		return
 	}
+	if !requireScope(c, models.ScopeUserAdmin) {
+		return
+	}
 
 	var request struct {
-		User string `json:"user" binding:"required"`
+		User        string   `json:"user" binding:"required"`
+		Rotate      bool     `json:"rotate"`      // Issue a new key and keep old keys valid for a grace period
+		GracePeriod *int64   `json:"gracePeriod"` // Seconds, only used when rotating
+		Description string   `json:"description"` // Description of the new key
+		Scopes      []string `json:"scopes"`      // Scopes of the new key
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -45,8 +60,13 @@ func (h *Handlers) PostUserResetKey(c *gin.Context) {
 		return
 	}
 
+	if request.Rotate {
+		h.rotateUserKeys(c, callerUserIdStr, userId, request.GracePeriod, request.Description, request.Scopes)
+		return
+	}
+
 	// Invalidate all existing API keys for the user
-	err := h.storage.InvalidateUserApiKeys(userId)
+	err := h.authService.InvalidateUserApiKeys(userId)
 	if err != nil {
 		log.Printf("PostUserResetKey: failed to invalidate API keys for user %s: %v", userId, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -54,27 +74,93 @@ func (h *Handlers) PostUserResetKey(c *gin.Context) {
 	}
 
 	// Log the API call as an internal event
+	if !h.addResetKeyEvent(c, callerUserIdStr, userId, models.ResetKeyPayload{}) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API keys invalidated successfully",
+	})
+}
+
+// rotateUserKeys issues a new API key for a user and keeps the old keys valid
+// for a grace period, for PostUserResetKey
+func (h *Handlers) rotateUserKeys(c *gin.Context, callerUserId, userId string, gracePeriodSeconds *int64, description string, scopes []string) {
+	gracePeriod := services.DefaultRotationGracePeriod
+	if gracePeriodSeconds != nil {
+		// Check the seconds before converting, as large values overflow a Duration
+		if *gracePeriodSeconds < 0 || *gracePeriodSeconds > int64(services.MaxRotationGracePeriod/time.Second) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": apperrors.ErrInvalidGracePeriod.Error()})
+			return
+		}
+		gracePeriod = time.Duration(*gracePeriodSeconds) * time.Second
+	}
+
+	if !requireGrantableScopes(c, scopes) {
+		return
+	}
+
+	oldKeysExpireAt := time.Now().Add(gracePeriod)
+	apiKey, plainKey, err := h.authService.RotateUserApiKeys(userId, oldKeysExpireAt, description, scopes)
+	if err != nil {
+		log.Printf("PostUserResetKey: failed to rotate API keys for user %s: %v", userId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Log the API call as an internal event
+	payload := models.ResetKeyPayload{
+		Rotate:          true,
+		GracePeriod:     int64(gracePeriod / time.Second),
+		OldKeysExpireAt: &oldKeysExpireAt,
+		KeyUuid:         apiKey.UUID,
+	}
+	if !h.addResetKeyEvent(c, callerUserId, userId, payload) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "API key rotated successfully",
+		"keyUuid":         apiKey.UUID,
+		"apiKey":          plainKey,
+		"user":            apiKey.User,
+		"description":     apiKey.Description,
+		"scopes":          apiKey.Scopes,
+		"oldKeysExpireAt": oldKeysExpireAt,
+	})
+}
+
+// addResetKeyEvent records a key reset as a .user.resetKey event, responding
+// with an error if it cannot be stored
+func (h *Handlers) addResetKeyEvent(c *gin.Context, callerUserId, userId string, payload models.ResetKeyPayload) bool {
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode reset key event for user %s: %v", userId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
 	event := models.NewEvent(
-		callerUserIdStr,
+		callerUserId,
 		".user."+userId,
 		".user.resetKey",
-		"{}",
+		string(payloadJson),
 	)
-	if err := h.storage.AddEvents([]models.Event{*event}); err != nil {
+	if err := h.addEvents([]models.Event{*event}); err != nil {
 		log.Printf("Failed to save reset key event for user %s: %v", userId, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
+		return false
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "API keys invalidated successfully",
-	})
+	return true
 }
 
 // PostUserGenerateToken handles POST /api/v1/user/generateToken
 func (h *Handlers) PostUserGenerateToken(c *gin.Context) {
 	var request struct {
-		User string `json:"user" binding:"required"`
+		User      string   `json:"user" binding:"required"`
+		Scopes    []string `json:"scopes"`
+		LongToken bool     `json:"longToken"`
+		TTL       int64    `json:"ttl"`     // Seconds; 0 for the default
+		MaxUses   int      `json:"maxUses"` // 0 for a single use
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -102,14 +188,34 @@ func (h *Handlers) PostUserGenerateToken(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
 		return
 	}
+	if !requireScope(c, models.ScopeUserAdmin) {
+		return
+	}
 
 	if !h.aclService.CheckPermission(callerUserIdStr, userId, ".user.generateToken") {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 		return
 	}
 
+	if !requireGrantableScopes(c, request.Scopes) {
+		return
+	}
+	ttl, ok := setupTokenTTL(c, request.TTL)
+	if !ok {
+		return
+	}
+
 	// Generate setup token
-	setupToken, err := h.authService.GenerateSetupToken(userId)
+	setupToken, err := h.authService.GenerateSetupTokenWithOptions(userId, models.SetupTokenOptions{
+		Scopes:  request.Scopes,
+		Long:    request.LongToken,
+		TTL:     ttl,
+		MaxUses: request.MaxUses,
+	})
+	if errors.Is(err, apperrors.ErrInvalidTokenTTL) || errors.Is(err, apperrors.ErrInvalidMaxUses) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Printf("PostUserGenerateToken: failed to generate setup token for user %s: %v", userId, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -117,13 +223,13 @@ func (h *Handlers) PostUserGenerateToken(c *gin.Context) {
 	}
 
 	// Log the API call as an internal event
-	event := models.Event{
-		User:    callerUserIdStr,
-		Item:    ".user." + userId,
-		Action:  ".user.generateToken",
-		Payload: "{}",
-	}
-	if err := h.storage.AddEvents([]models.Event{event}); err != nil {
+	event := models.NewEvent(
+		callerUserIdStr,
+		".user."+userId,
+		".user.generateToken",
+		"{}",
+	)
+	if err := h.addEvents([]models.Event{*event}); err != nil {
 		log.Printf("Failed to save generate token event for user %s: %v", userId, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
@@ -132,6 +238,7 @@ func (h *Handlers) PostUserGenerateToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"token":     setupToken.Token,
 		"expiresAt": setupToken.ExpiresAt,
+		"scopes":    setupToken.Scopes,
 	})
 }
 
@@ -147,22 +254,48 @@ func (h *Handlers) PostSetupExchangeToken(c *gin.Context) {
 		return
 	}
 
-	// Exchange setup token for API key
-	apiKey, plainKey, err := h.authService.ExchangeSetupToken(request.Token, request.Description)
+	// Reject clients locked out after repeated failures before checking the token
+	clientIP := c.ClientIP()
+	if wait, ok := h.exchangeThrottle.Allow(clientIP); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		return
+	}
+
+	// Exchange setup token for API key, creating the user of an invitation.
+	// The events are published under the write lock like those of addEvents.
+	h.writeMutex.Lock()
+	apiKey, plainKey, events, err := h.authService.RedeemSetupToken(request.Token, request.Description)
+	if err == nil {
+		h.eventsStored(events)
+	}
+	h.writeMutex.Unlock()
+	if errors.Is(err, storage.ErrUserExists) {
+		// The invited user was created by other means in the meantime
+		h.exchangeThrottle.Release(clientIP)
+		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to exchange setup token: %v", err)
+		if errors.Is(err, apperrors.ErrInvalidSetupToken) || errors.Is(err, apperrors.ErrSetupTokenExpired) {
+			h.recordExchangeFailure(clientIP, err)
+		} else {
+			h.exchangeThrottle.Release(clientIP)
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to exchange setup token"})
 		return
 	}
+	h.exchangeThrottle.Success(clientIP)
 
 	// Log the API call as an internal event
-	event := models.Event{
-		User:    apiKey.User,
-		Item:    ".user." + apiKey.User,
-		Action:  ".user.exchangeToken",
-		Payload: "{}",
-	}
-	if err := h.storage.AddEvents([]models.Event{event}); err != nil {
+	event := models.NewEvent(
+		apiKey.User,
+		".user."+apiKey.User,
+		".user.exchangeToken",
+		"{}",
+	)
+	if err := h.addEvents([]models.Event{*event}); err != nil {
 		log.Printf("Failed to save exchange token event for user %s: %v", apiKey.User, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
@@ -173,5 +306,32 @@ func (h *Handlers) PostSetupExchangeToken(c *gin.Context) {
 		"apiKey":      plainKey,
 		"user":        apiKey.User,
 		"description": apiKey.Description,
+		"scopes":      apiKey.Scopes,
 	})
 }
+
+// recordExchangeFailure counts a failed setup token exchange towards the
+// client's lockout and logs it as a .user.exchangeTokenFailed event. The token
+// is not logged, as it may be a mistyped valid token, and the client IP is only
+// written to the server log, as events are kept and synced indefinitely.
+func (h *Handlers) recordExchangeFailure(clientIP string, reason error) {
+	failures, lockout := h.exchangeThrottle.Failure(clientIP)
+	if lockout > 0 {
+		log.Printf("PostSetupExchangeToken: %d failed attempts from %s, locked out for %s", failures, clientIP, lockout)
+	}
+
+	payload, _ := json.Marshal(models.ExchangeTokenFailedPayload{
+		Reason:   reason.Error(),
+		Failures: failures,
+		Lockout:  int64(math.Ceil(lockout.Seconds())),
+	})
+	event := models.NewEvent(
+		".anonymous",
+		".user",
+		".user.exchangeTokenFailed",
+		string(payload),
+	)
+	if err := h.addEvents([]models.Event{*event}); err != nil {
+		log.Printf("Failed to save exchange token failure event: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	apperrors "simple-sync/src/errors"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PostUserInvite handles POST /api/v1/user/invite for inviting a new user.
+// The invitation token creates the user and installs the given ACL rules when
+// it is first exchanged.
+func (h *Handlers) PostUserInvite(c *gin.Context) {
+	var request struct {
+		User      string           `json:"user" binding:"required"`
+		AclRules  []models.AclRule `json:"aclRules"`
+		Scopes    []string         `json:"scopes"`
+		LongToken bool             `json:"longToken"`
+		TTL       int64            `json:"ttl"`     // Seconds; 0 for the default
+		MaxUses   int              `json:"maxUses"` // 0 for a single use
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Printf("PostUserInvite: invalid request format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	callerUserId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	callerUserIdStr, ok := callerUserId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if !requireScope(c, models.ScopeUserAdmin) {
+		return
+	}
+
+	// The caller needs the permissions of the events the invitation will emit
+	userItem := ".user." + request.User
+	if !h.aclService.CheckPermission(callerUserIdStr, userItem, ".user.create") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+	if len(request.AclRules) > 0 {
+		if !requireScope(c, models.ScopeAclWrite) {
+			return
+		}
+		if !h.aclService.CheckPermission(callerUserIdStr, ".acl", ".acl.addRule") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+	}
+
+	for _, rule := range request.AclRules {
+		if err := rule.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !requireGrantableScopes(c, request.Scopes) {
+		return
+	}
+	ttl, ok := setupTokenTTL(c, request.TTL)
+	if !ok {
+		return
+	}
+
+	setupToken, err := h.authService.GenerateInvitation(callerUserIdStr, request.User, request.AclRules, models.SetupTokenOptions{
+		Scopes:  request.Scopes,
+		Long:    request.LongToken,
+		TTL:     ttl,
+		MaxUses: request.MaxUses,
+	})
+	if errors.Is(err, storage.ErrUserExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+		return
+	}
+	if errors.Is(err, apperrors.ErrInvalidTokenTTL) || errors.Is(err, apperrors.ErrInvalidMaxUses) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("PostUserInvite: failed to generate invitation for user %s: %v", request.User, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Log the API call as an internal event
+	payload, _ := json.Marshal(models.InvitePayload{AclRules: request.AclRules, Scopes: request.Scopes})
+	event := models.NewEvent(
+		callerUserIdStr,
+		userItem,
+		".user.invite",
+		string(payload),
+	)
+	if err := h.addEvents([]models.Event{*event}); err != nil {
+		log.Printf("Failed to save invite event for user %s: %v", request.User, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     setupToken.Token,
+		"expiresAt": setupToken.ExpiresAt,
+		"scopes":    setupToken.Scopes,
+		"user":      setupToken.User,
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserKeys handles GET /api/v1/user/keys for listing the API keys of a user
+func (h *Handlers) GetUserKeys(c *gin.Context) {
+	callerUserId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	callerUserIdStr, ok := callerUserId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if !requireScope(c, models.ScopeUserAdmin) {
+		return
+	}
+
+	// Default to the caller's own keys
+	userId := c.DefaultQuery("user", callerUserIdStr)
+
+	if !h.aclService.CheckPermission(callerUserIdStr, ".user."+userId, ".user.listKeys") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	apiKeys, err := h.storage.GetUserApiKeys(userId)
+	if err != nil {
+		log.Printf("GetUserKeys: failed to load API keys for user %s: %v", userId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	keys := make([]models.ApiKeyInfo, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		keys = append(keys, apiKey.Info())
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// GetUserKey handles GET /api/v1/user/keys/:uuid for describing a single API key
+func (h *Handlers) GetUserKey(c *gin.Context) {
+	apiKey, ok := h.authorizeUserKey(c, ".user.listKeys")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKey.Info())
+}
+
+// DeleteUserKey handles DELETE /api/v1/user/keys/:uuid for revoking a single API key
+func (h *Handlers) DeleteUserKey(c *gin.Context) {
+	apiKey, ok := h.authorizeUserKey(c, ".user.revokeKey")
+	if !ok {
+		return
+	}
+
+	err := h.authService.RevokeApiKey(apiKey.UUID)
+	if err == storage.ErrApiKeyNotFound {
+		// Revoked concurrently
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("DeleteUserKey: failed to revoke API key %s: %v", apiKey.UUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Log the API call as an internal event
+	payload, _ := json.Marshal(models.RevokeKeyPayload{KeyUuid: apiKey.UUID})
+	event := models.NewEvent(
+		c.GetString("user_id"),
+		".user."+apiKey.User,
+		".user.revokeKey",
+		string(payload),
+	)
+	if err := h.addEvents([]models.Event{*event}); err != nil {
+		log.Printf("Failed to save revoke key event for user %s: %v", apiKey.User, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked successfully",
+	})
+}
+
+// authorizeUserKey loads the API key named in the URL and checks that the
+// caller has the given permission on its owner, responding with an error if not
+func (h *Handlers) authorizeUserKey(c *gin.Context, action string) (*models.ApiKey, bool) {
+	callerUserId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil, false
+	}
+
+	callerUserIdStr, ok := callerUserId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	if !requireScope(c, models.ScopeUserAdmin) {
+		return nil, false
+	}
+
+	apiKey, err := h.storage.GetApiKeyByUuid(c.Param("uuid"))
+	if err == storage.ErrApiKeyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("authorizeUserKey: failed to load API key %s: %v", c.Param("uuid"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+
+	if !h.aclService.CheckPermission(callerUserIdStr, ".user."+apiKey.User, action) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return nil, false
+	}
+
+	return apiKey, true
+}
+
+// GetUserMe handles GET /api/v1/user/me for identifying the caller's API key
+func (h *Handlers) GetUserMe(c *gin.Context) {
+	callerUserId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":   callerUserId,
+		"scopes": c.GetStringSlice("scopes"),
+	})
+}
+
+// GetUsers handles GET /api/v1/users for listing all users
+func (h *Handlers) GetUsers(c *gin.Context) {
+	callerUserId, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	callerUserIdStr, ok := callerUserId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if !requireScope(c, models.ScopeUserAdmin) {
+		return
+	}
+
+	if !h.aclService.CheckPermission(callerUserIdStr, ".user", ".user.list") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	users, err := h.storage.GetUsers()
+	if err != nil {
+		log.Printf("GetUsers: failed to load users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
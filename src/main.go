@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,6 +12,7 @@ import (
 	"syscall"
 	"time"
 
+	"simple-sync/src/cli"
 	"simple-sync/src/handlers"
 	"simple-sync/src/middleware"
 	"simple-sync/src/models"
@@ -20,6 +22,19 @@ import (
 )
 
 func main() {
+	// Run the server unless another command is given
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] != "serve" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := cli.NewApp().Run(ctx, args)
+		stop()
+		os.Exit(code)
+	}
+	serve()
+}
+
+// serve runs the HTTP server until it receives an interrupt signal
+func serve() {
 	// Print version information
 	log.Printf("Simple-Sync v%s (build: %s)", Version, BuildTime)
 	log.Printf("Starting application...")
@@ -87,12 +102,23 @@ func main() {
 	auth := v1.Group("/")
 	auth.Use(middleware.AuthMiddleware(h.AuthService()))
 	auth.GET("/events", h.GetEvents)
+	auth.GET("/events/stream", h.GetEventsStream)
 	auth.POST("/events", h.PostEvents)
+	auth.GET("/acl", h.GetAcl)
 	auth.POST("/acl", h.PostAcl)
+	auth.POST("/acl/remove", h.PostAclRemove)
+	auth.POST("/acl/check", h.PostAclCheck)
+	auth.GET("/sync", h.GetSync)
 
 	// Auth routes (with middleware for permission checks)
 	auth.POST("/user/resetKey", h.PostUserResetKey)
 	auth.POST("/user/generateToken", h.PostUserGenerateToken)
+	auth.POST("/user/invite", h.PostUserInvite)
+	auth.GET("/users", h.GetUsers)
+	auth.GET("/user/me", h.GetUserMe)
+	auth.GET("/user/keys", h.GetUserKeys)
+	auth.GET("/user/keys/:uuid", h.GetUserKey)
+	auth.DELETE("/user/keys/:uuid", h.DeleteUserKey)
 
 	// Setup routes (no middleware - token-based auth)
 	v1.POST("/user/exchangeToken", h.PostSetupExchangeToken)
@@ -100,15 +126,27 @@ func main() {
 	// Health check route (no middleware)
 	v1.GET("/health", h.GetHealth)
 
+	// Version 2 of the event routes, with millisecond timestamps
+	v2 := router.Group("/api/v2")
+	authV2 := v2.Group("/")
+	authV2.Use(middleware.AuthMiddleware(h.AuthService()), middleware.ApiVersion(2))
+	authV2.GET("/events", h.GetEvents)
+	authV2.GET("/events/stream", h.GetEventsStream)
+	authV2.POST("/events", h.PostEvents)
+
 	// Use port from environment configuration
 	port := envConfig.Port
 
 	// Start server with graceful shutdown
 	addr := ":" + strconv.Itoa(port)
+	// Request contexts are cancelled on shutdown so long-lived event streams close
+	baseCtx, cancelBaseCtx := context.WithCancel(context.Background())
 	srv := &http.Server{
-		Addr:    addr,
-		Handler: router,
+		Addr:        addr,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
 	}
+	srv.RegisterOnShutdown(cancelBaseCtx)
 
 	// Start server in background
 	go func() {
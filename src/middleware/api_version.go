@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// ApiVersion creates middleware recording the API version of a route group,
+// which selects the representation of events in requests and responses
+func ApiVersion(version int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("api_version", version)
+		c.Next()
+	}
+}
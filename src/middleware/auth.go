@@ -20,15 +20,17 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		}
 
 		// Validate API key
-		userID, err := authService.ValidateApiKey(apiKey)
+		apiKeyModel, err := authService.AuthenticateApiKey(apiKey)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
 			c.Abort()
 			return
 		}
 
-		// Set user information in context
-		c.Set("user_id", userID)
+		// Set user information in context. Handlers enforce the key's scopes
+		// in addition to the user's ACL permissions.
+		c.Set("user_id", apiKeyModel.User)
+		c.Set("scopes", apiKeyModel.Scopes)
 
 		c.Next()
 	}
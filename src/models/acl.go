@@ -81,6 +81,23 @@ func (r *AclRule) validatePattern(pattern, fieldType string) error {
 	return nil
 }
 
+// MatchesPattern checks if value matches a pattern (exact value, prefix wildcard or "*")
+func MatchesPattern(pattern, value string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		prefix := strings.TrimSuffix(pattern, "*")
+		return strings.HasPrefix(value, prefix)
+	}
+	return pattern == value
+}
+
+// isValidPattern checks that a pattern has at most one wildcard, at the end
+func isValidPattern(pattern string) bool {
+	return !strings.Contains(strings.TrimSuffix(pattern, "*"), "*")
+}
+
 // containsControlChars checks if string contains control characters
 func (r *AclRule) containsControlChars(s string) bool {
 	for _, r := range s {
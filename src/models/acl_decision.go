@@ -0,0 +1,27 @@
+package models
+
+// AclRuleMatch is an ACL rule that applies to a permission check, with the
+// specificity scores used to order it
+type AclRuleMatch struct {
+	AclRule
+	ItemSpecificity   float64 `json:"itemSpecificity"`
+	UserSpecificity   float64 `json:"userSpecificity"`
+	ActionSpecificity float64 `json:"actionSpecificity"`
+}
+
+// AclDecision explains the outcome of a permission check
+type AclDecision struct {
+	User    string         `json:"user"`
+	Item    string         `json:"item"`
+	Action  string         `json:"action"`
+	Allowed bool           `json:"allowed"`
+	Reason  string         `json:"reason"`
+	Rules   []AclRuleMatch `json:"rules"` // Matching rules, the deciding rule first
+}
+
+// Reasons for an ACL decision
+const (
+	AclReasonRoot    = "root"    // The root user bypasses the ACL
+	AclReasonRule    = "rule"    // Decided by the first matching rule
+	AclReasonDefault = "default" // No rule matched, denied by default
+)
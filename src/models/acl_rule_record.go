@@ -0,0 +1,46 @@
+package models
+
+import (
+	apperrors "simple-sync/src/errors"
+)
+
+// AclRuleRecord is a current ACL rule together with the .acl.addRule event
+// that created it
+type AclRuleRecord struct {
+	AclRule
+	EventUuid string `json:"eventUuid"` // Empty for rules not created through an event
+	Author    string `json:"author"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// AclRuleQuery filters ACL rules by user, item and action. Filters use the
+// same pattern syntax as ACL rules and are matched against the rule's fields.
+type AclRuleQuery struct {
+	User   string
+	Item   string
+	Action string
+}
+
+// Validate performs validation on the AclRuleQuery struct
+func (q *AclRuleQuery) Validate() error {
+	for _, pattern := range []string{q.User, q.Item, q.Action} {
+		if !isValidPattern(pattern) {
+			return apperrors.ErrInvalidFilter
+		}
+	}
+	return nil
+}
+
+// Matches checks if a rule satisfies the filters of the query
+func (q *AclRuleQuery) Matches(r *AclRule) bool {
+	if q.User != "" && !MatchesPattern(q.User, r.User) {
+		return false
+	}
+	if q.Item != "" && !MatchesPattern(q.Item, r.Item) {
+		return false
+	}
+	if q.Action != "" && !MatchesPattern(q.Action, r.Action) {
+		return false
+	}
+	return true
+}
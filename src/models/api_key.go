@@ -11,11 +11,14 @@ import (
 // ApiKey represents a long-lived API key for user authentication
 type ApiKey struct {
 	UUID        string     `json:"uuid" db:"uuid"`
+	KeyId       string     `json:"key_id,omitempty" db:"key_id"` // Public ID embedded in the key; empty for legacy keys
 	User        string     `json:"user" db:"user"`
 	KeyHash     string     `json:"key_hash" db:"key_hash"`
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
 	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
 	Description string     `json:"description,omitempty" db:"description"`
+	Scopes      []string   `json:"scopes,omitempty" db:"scopes"`         // Empty for unrestricted keys
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"` // Nil for keys that never expire
 }
 
 // Validate performs validation on the ApiKey struct
@@ -41,6 +44,10 @@ func (k *ApiKey) Validate() error {
 		return apperrors.ErrCreatedAtRequired
 	}
 
+	if err := ValidateScopes(k.Scopes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -58,8 +65,69 @@ func NewApiKey(userID, keyHash, description string) *ApiKey {
 	}
 }
 
+// IsExpired checks if the key has passed its expiry time
+func (k *ApiKey) IsExpired() bool {
+	return k.ExpiresAt != nil && !time.Now().Before(*k.ExpiresAt)
+}
+
 // UpdateLastUsed updates the last used timestamp
 func (k *ApiKey) UpdateLastUsed() {
 	now := time.Now()
 	k.LastUsedAt = &now
 }
+
+// ApiKeyInfo describes an API key to its owner, without the key hash
+type ApiKeyInfo struct {
+	UUID        string     `json:"uuid"`
+	KeyId       string     `json:"keyId,omitempty"` // Matches the ID part of the key; empty for legacy keys
+	User        string     `json:"user"`
+	Description string     `json:"description"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+// Info returns the public description of the key
+func (k *ApiKey) Info() ApiKeyInfo {
+	scopes := k.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return ApiKeyInfo{
+		UUID:        k.UUID,
+		KeyId:       k.KeyId,
+		User:        k.User,
+		Description: k.Description,
+		Scopes:      scopes,
+		CreatedAt:   k.CreatedAt,
+		LastUsedAt:  k.LastUsedAt,
+		ExpiresAt:   k.ExpiresAt,
+	}
+}
+
+// RevokeKeyPayload is the payload of a .user.revokeKey event
+type RevokeKeyPayload struct {
+	KeyUuid string `json:"keyUuid"`
+}
+
+// InvitePayload is the payload of a .user.invite event
+type InvitePayload struct {
+	AclRules []AclRule `json:"aclRules,omitempty"` // Rules installed when the invitation is exchanged
+	Scopes   []string  `json:"scopes,omitempty"`   // Scopes of the API keys issued for the invitation
+}
+
+// ResetKeyPayload is the payload of a .user.resetKey event
+type ResetKeyPayload struct {
+	Rotate          bool       `json:"rotate"`
+	GracePeriod     int64      `json:"gracePeriod,omitempty"`     // Seconds the old keys stay valid when rotating
+	OldKeysExpireAt *time.Time `json:"oldKeysExpireAt,omitempty"` // When the old keys stop working when rotating
+	KeyUuid         string     `json:"keyUuid,omitempty"`         // UUID of the key issued when rotating
+}
+
+// ExchangeTokenFailedPayload is the payload of a .user.exchangeTokenFailed event
+type ExchangeTokenFailedPayload struct {
+	Reason   string `json:"reason"`
+	Failures int    `json:"failures"` // Recent failures from the client IP
+	Lockout  int64  `json:"lockout"`  // Seconds the client is now locked out for
+}
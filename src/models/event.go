@@ -19,22 +19,123 @@ type Event struct {
 	Item      string `json:"item" db:"item"`
 	Action    string `json:"action" db:"action"`
 	Payload   string `json:"payload" db:"payload"`
+	// TimestampMs is the millisecond time encoded in the UUID. Timestamp holds
+	// it in seconds, as shown to v1 clients.
+	TimestampMs uint64 `json:"-" db:"timestamp_ms"`
+	// Seq is assigned by the server when the event is stored and gives the
+	// order of all events. It is ignored in submitted events.
+	Seq uint64 `json:"seq,omitempty" db:"seq"`
+}
+
+// Outcomes of submitting an event
+const (
+	EventStatusAccepted  = "accepted"  // The event was stored
+	EventStatusDuplicate = "duplicate" // An identical event was already stored
+	EventStatusRejected  = "rejected"  // The event was not stored, see the error
+)
+
+// EventResult is the outcome of submitting a single event
+type EventResult struct {
+	UUID   string `json:"uuid"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Err    error  `json:"-"` // The error rejecting the event, if any
+}
+
+// EventV2 is the representation of an event in version 2 of the API, with a
+// millisecond timestamp
+type EventV2 struct {
+	UUID      string `json:"uuid"`
+	Timestamp uint64 `json:"timestamp"` // Milliseconds since the epoch
+	User      string `json:"user"`
+	Item      string `json:"item"`
+	Action    string `json:"action"`
+	Payload   string `json:"payload"`
+	Seq       uint64 `json:"seq,omitempty"`
 }
 
 func NewEvent(User, Item, Action, Payload string) *Event {
 	eventUuid, _ := uuid.NewV7()
-	unixTimeSeconds, _ := eventUuid.Time().UnixTime()
+	timestampMs := uuidTimeMs(eventUuid)
 
 	return &Event{
-		UUID:      eventUuid.String(),
-		Timestamp: uint64(unixTimeSeconds),
-		User:      User,
-		Item:      Item,
-		Action:    Action,
-		Payload:   Payload,
+		UUID:        eventUuid.String(),
+		Timestamp:   timestampMs / 1000,
+		TimestampMs: timestampMs,
+		User:        User,
+		Item:        Item,
+		Action:      Action,
+		Payload:     Payload,
 	}
 }
 
+// uuidTimeMs returns the unix time in milliseconds encoded in a UUIDv7
+func uuidTimeMs(id uuid.UUID) uint64 {
+	sec, nsec := id.Time().UnixTime()
+	return uint64(sec)*1000 + uint64(nsec)/1e6
+}
+
+// UuidTimestampMs returns the millisecond time encoded in the event's UUID, or
+// 0 if the UUID is invalid
+func (e *Event) UuidTimestampMs() uint64 {
+	parsedUuid, err := uuid.Parse(e.UUID)
+	if err != nil {
+		return 0
+	}
+	return uuidTimeMs(parsedUuid)
+}
+
+// UnmarshalJSON decodes the v1 representation of an event. The millisecond
+// timestamp is taken from the UUID, since v1 only carries seconds.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	type plainEvent Event
+	if err := json.Unmarshal(data, (*plainEvent)(e)); err != nil {
+		return err
+	}
+	e.TimestampMs = e.UuidTimestampMs()
+	return nil
+}
+
+// V2 converts the event to its v2 representation
+func (e *Event) V2() EventV2 {
+	timestampMs := e.TimestampMs
+	if timestampMs == 0 {
+		timestampMs = e.UuidTimestampMs()
+	}
+	return EventV2{
+		UUID:      e.UUID,
+		Timestamp: timestampMs,
+		User:      e.User,
+		Item:      e.Item,
+		Action:    e.Action,
+		Payload:   e.Payload,
+		Seq:       e.Seq,
+	}
+}
+
+// Event converts a v2 event to an Event, with the timestamp in both precisions
+func (e *EventV2) Event() Event {
+	return Event{
+		UUID:        e.UUID,
+		Timestamp:   e.Timestamp / 1000,
+		TimestampMs: e.Timestamp,
+		User:        e.User,
+		Item:        e.Item,
+		Action:      e.Action,
+		Payload:     e.Payload,
+		Seq:         e.Seq,
+	}
+}
+
+// EventsV2 converts events to their v2 representation
+func EventsV2(events []Event) []EventV2 {
+	converted := make([]EventV2, len(events))
+	for i := range events {
+		converted[i] = events[i].V2()
+	}
+	return converted
+}
+
 func (e *Event) IsApiOnlyEvent() bool {
 	// .user.create is the ONLY internal event action that can be triggered
 	// by a user
@@ -45,6 +146,11 @@ func (e *Event) IsAclEvent() bool {
 	return e.Item == ".acl"
 }
 
+// IsUserCreateEvent checks if the event creates a new user
+func (e *Event) IsUserCreateEvent() bool {
+	return e.Action == ".user.create"
+}
+
 // Validate performs validation on the Event struct
 func (e *Event) Validate() error {
 	if e.UUID == "" {
@@ -57,11 +163,16 @@ func (e *Event) Validate() error {
 		return apperrors.ErrInvalidUuidFormat
 	}
 
-	// Validate that timestamp matches the UUID v7 timestamp
-	timestamp, _ := parsedUuid.Time().UnixTime()
+	// Validate that timestamp matches the UUID v7 timestamp, in milliseconds
+	// if given
+	timestampMs := uuidTimeMs(parsedUuid)
+	timestamp := int64(timestampMs / 1000)
 	if uint64(timestamp) != e.Timestamp {
 		return apperrors.ErrInvalidTimestamp
 	}
+	if e.TimestampMs != 0 && e.TimestampMs != timestampMs {
+		return apperrors.ErrInvalidTimestamp
+	}
 
 	// Do not allow timestamps of 0
 	if uint64(timestamp) == 0 {
@@ -90,6 +201,30 @@ func (e *Event) Validate() error {
 	return nil
 }
 
+// SameContent reports whether two events are identical apart from their
+// sequence number, so that storing one when the other exists is a retry
+// rather than a conflict
+func (e *Event) SameContent(other *Event) bool {
+	return e.UUID == other.UUID && e.Timestamp == other.Timestamp && e.User == other.User &&
+		e.Item == other.Item && e.Action == other.Action && e.Payload == other.Payload
+}
+
+// ToUser converts a .user.create event to the User it creates.
+// The new user's ID is given by the event's item, for example ".user.bob".
+func (e *Event) ToUser() (*User, error) {
+	if !e.IsUserCreateEvent() {
+		return nil, fmt.Errorf("not a user create event")
+	}
+	id, found := strings.CutPrefix(e.Item, ".user.")
+	if !found || id == "" {
+		return nil, apperrors.ErrInvalidUserItem
+	}
+	return &User{
+		Id:        id,
+		CreatedAt: time.Unix(int64(e.Timestamp), 0),
+	}, nil
+}
+
 // ToAclRule converts an ACL event to AclRule
 func (e *Event) ToAclRule() (*AclRule, error) {
 	if !e.IsAclEvent() {
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"github.com/google/uuid"
+
+	apperrors "simple-sync/src/errors"
+)
+
+// EventQuery describes which events to load from storage
+type EventQuery struct {
+	// Cursors: only return events stored after the event with the UUID After,
+	// or with a sequence number greater than AfterSeq. At most one can be given.
+	After    string
+	AfterSeq uint64
+	Limit    int // Maximum number of events to return (0 means no limit)
+
+	// Filters use the same pattern syntax as ACL rules (exact value, prefix wildcard or "*")
+	User   string
+	Item   string
+	Action string
+
+	// Inclusive timestamp range in seconds and in milliseconds (0 means unbounded)
+	From   uint64
+	To     uint64
+	FromMs uint64
+	ToMs   uint64
+}
+
+// Validate performs validation on the EventQuery struct
+func (q *EventQuery) Validate() error {
+	if q.After != "" {
+		if _, err := uuid.Parse(q.After); err != nil {
+			return apperrors.ErrInvalidCursor
+		}
+		if q.AfterSeq != 0 {
+			return apperrors.ErrConflictingCursors
+		}
+	}
+
+	if q.Limit < 0 {
+		return apperrors.ErrInvalidLimit
+	}
+
+	for _, pattern := range []string{q.User, q.Item, q.Action} {
+		if !isValidPattern(pattern) {
+			return apperrors.ErrInvalidFilter
+		}
+	}
+
+	if q.From != 0 && q.To != 0 && q.From > q.To {
+		return apperrors.ErrInvalidTimeRange
+	}
+	if q.FromMs != 0 && q.ToMs != 0 && q.FromMs > q.ToMs {
+		return apperrors.ErrInvalidTimeRange
+	}
+
+	return nil
+}
+
+// Matches checks if an event satisfies the sequence cursor and filters of the
+// query. A UUID cursor must first be resolved to the sequence number of its event.
+func (q *EventQuery) Matches(e *Event) bool {
+	if e.Seq <= q.AfterSeq {
+		return false
+	}
+	if q.User != "" && !MatchesPattern(q.User, e.User) {
+		return false
+	}
+	if q.Item != "" && !MatchesPattern(q.Item, e.Item) {
+		return false
+	}
+	if q.Action != "" && !MatchesPattern(q.Action, e.Action) {
+		return false
+	}
+	if q.From != 0 && e.Timestamp < q.From {
+		return false
+	}
+	if q.To != 0 && e.Timestamp > q.To {
+		return false
+	}
+	if q.FromMs != 0 && e.TimestampMs < q.FromMs {
+		return false
+	}
+	if q.ToMs != 0 && e.TimestampMs > q.ToMs {
+		return false
+	}
+	return true
+}
+
+// EventPage represents one page of events returned to a syncing client
+type EventPage struct {
+	Events  []Event `json:"events"`
+	Next    string  `json:"next"`              // UUID of the last event, the cursor for the next page
+	NextSeq uint64  `json:"nextSeq,omitempty"` // Sequence number of the last event, an alternative cursor
+	HasMore bool    `json:"hasMore"`
+}
+
+// NewEventPage builds a page of up to limit events from the events loaded for
+// a query that asked for one extra event to find out if there are more pages
+func NewEventPage(events []Event, query EventQuery, limit int) *EventPage {
+	page := &EventPage{
+		Events:  events,
+		Next:    query.After,
+		NextSeq: query.AfterSeq,
+		HasMore: len(events) > limit,
+	}
+	if page.HasMore {
+		page.Events = events[:limit]
+	}
+	if len(page.Events) > 0 {
+		page.Next = page.Events[len(page.Events)-1].UUID
+		page.NextSeq = page.Events[len(page.Events)-1].Seq
+	}
+	return page
+}
+
+// EventPageV2 is an EventPage in the v2 representation
+type EventPageV2 struct {
+	Events  []EventV2 `json:"events"`
+	Next    string    `json:"next"`
+	NextSeq uint64    `json:"nextSeq,omitempty"`
+	HasMore bool      `json:"hasMore"`
+}
+
+// V2 converts the page to its v2 representation
+func (p *EventPage) V2() EventPageV2 {
+	return EventPageV2{
+		Events:  EventsV2(p.Events),
+		Next:    p.Next,
+		NextSeq: p.NextSeq,
+		HasMore: p.HasMore,
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"slices"
+	"strings"
+
+	apperrors "simple-sync/src/errors"
+)
+
+// API key scopes. A key with no scopes is unrestricted and grants all of its
+// user's permissions; scopes only ever narrow what the ACL allows.
+const (
+	ScopeEventsRead  = "events:read"  // Read and stream events
+	ScopeEventsWrite = "events:write" // Submit events
+	ScopeAclRead     = "acl:read"     // List and check ACL rules
+	ScopeAclWrite    = "acl:write"    // Add and remove ACL rules
+	ScopeUserAdmin   = "user:admin"   // Create users and manage their keys and tokens
+)
+
+// validScopes lists every recognised scope
+var validScopes = []string{ScopeEventsRead, ScopeEventsWrite, ScopeAclRead, ScopeAclWrite, ScopeUserAdmin}
+
+// ValidateScopes checks that every scope is recognised
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(validScopes, scope) {
+			return apperrors.ErrInvalidScope
+		}
+	}
+	return nil
+}
+
+// HasScope checks if a set of scopes grants scope. An empty set is unrestricted.
+func HasScope(scopes []string, scope string) bool {
+	return len(scopes) == 0 || slices.Contains(scopes, scope)
+}
+
+// ScopesSubset checks if every scope in requested is granted by scopes
+func ScopesSubset(requested, scopes []string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	if len(requested) == 0 {
+		return false
+	}
+	for _, scope := range requested {
+		if !slices.Contains(scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatScopes joins scopes for storage
+func FormatScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// ParseScopes splits scopes read from storage
+func ParseScopes(s string) []string {
+	return strings.Fields(s)
+}
@@ -1,18 +1,38 @@
 package models
 
 import (
+	"encoding/json"
 	"regexp"
 	"time"
 
 	apperrors "simple-sync/src/errors"
 )
 
+// tokenRegex matches short and long setup tokens
+var tokenRegex = regexp.MustCompile(`^[A-Z0-9]{4}-[A-Z0-9]{4}(-[A-Z0-9]{4}-[A-Z0-9]{4}-[A-Z0-9]{4}-[A-Z0-9]{4})?$`)
+
 // SetupToken represents a short-lived token for initial user authentication setup
 type SetupToken struct {
 	Token     string    `json:"token" db:"token"`
 	User      string    `json:"user" db:"user"`
 	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
-	UsedAt    time.Time `json:"used_at" db:"used_at"`
+	UsedAt    time.Time `json:"used_at" db:"used_at"`         // Time of the last use
+	Scopes    []string  `json:"scopes,omitempty" db:"scopes"` // Scopes of the API key issued for the token
+	MaxUses   int       `json:"max_uses" db:"max_uses"`       // Number of API keys the token can be exchanged for; 0 means 1
+	UseCount  int       `json:"use_count" db:"use_count"`     // Number of times the token was exchanged
+
+	// Invitations create their user and install their ACL rules on the first exchange
+	Invitation bool      `json:"invitation,omitempty" db:"invitation"`
+	AclRules   []AclRule `json:"acl_rules,omitempty" db:"acl_rules"`
+	CreatedBy  string    `json:"created_by,omitempty" db:"created_by"` // User who created the invitation
+}
+
+// SetupTokenOptions configures a new setup token
+type SetupTokenOptions struct {
+	Scopes  []string      // Scopes of the issued API key; empty for an unrestricted key
+	Long    bool          // Use a 24 character token instead of 8 characters
+	TTL     time.Duration // How long the token is valid; 0 for the default
+	MaxUses int           // Number of API keys the token can be exchanged for; 0 for a single use
 }
 
 // Validate performs validation on the SetupToken struct
@@ -21,8 +41,7 @@ func (t *SetupToken) Validate() error {
 		return apperrors.ErrTokenRequired
 	}
 
-	// Validate token format: XXXX-XXXX
-	tokenRegex := regexp.MustCompile(`^[A-Z0-9]{4}-[A-Z0-9]{4}$`)
+	// Validate token format: XXXX-XXXX, or XXXX-XXXX-XXXX-XXXX-XXXX-XXXX for long tokens
 	if !tokenRegex.MatchString(t.Token) {
 		return apperrors.ErrTokenInvalidFormat
 	}
@@ -35,6 +54,20 @@ func (t *SetupToken) Validate() error {
 		return apperrors.ErrExpiresAtRequired
 	}
 
+	if err := ValidateScopes(t.Scopes); err != nil {
+		return err
+	}
+
+	if t.MaxUses < 0 {
+		return apperrors.ErrInvalidMaxUses
+	}
+
+	for i := range t.AclRules {
+		if err := t.AclRules[i].Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -43,13 +76,25 @@ func (t *SetupToken) IsExpired() bool {
 	return time.Now().After(t.ExpiresAt)
 }
 
+// RemainingUses returns how many more times the token can be exchanged
+func (t *SetupToken) RemainingUses() int {
+	return max(max(t.MaxUses, 1)-t.UseCount, 0)
+}
+
 // IsValid checks if the token is valid for use
 func (t *SetupToken) IsValid() bool {
-	return t.UsedAt.IsZero() && !t.IsExpired()
+	return t.RemainingUses() > 0 && !t.IsExpired()
 }
 
-// MarkUsed marks the token as used
+// MarkUsed records a use of the token
 func (t *SetupToken) MarkUsed() {
+	t.UseCount++
+	t.UsedAt = time.Now()
+}
+
+// Invalidate uses up all remaining uses of the token
+func (t *SetupToken) Invalidate() {
+	t.UseCount = max(t.MaxUses, 1)
 	t.UsedAt = time.Now()
 }
 
@@ -60,5 +105,20 @@ func NewSetupToken(token, userID string, expiresAt time.Time) *SetupToken {
 		User:      userID,
 		ExpiresAt: expiresAt,
 		UsedAt:    time.Time{}, // zero value indicates not used
+		MaxUses:   1,
+	}
+}
+
+// InvitationEvents returns the internal events that create the user of an
+// invitation and install its ACL rules, authored by the user who created it
+func (t *SetupToken) InvitationEvents() ([]Event, error) {
+	events := []Event{*NewEvent(t.CreatedBy, ".user."+t.User, ".user.create", "{}")}
+	for _, rule := range t.AclRules {
+		ruleJson, err := json.Marshal(rule)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *NewEvent(t.CreatedBy, ".acl", ".acl.addRule", string(ruleJson)))
 	}
+	return events, nil
 }
@@ -0,0 +1,40 @@
+package models
+
+// SyncProtocolVersion is the version of the WebSocket sync frame format
+const SyncProtocolVersion = 1
+
+// Sync frame types sent by clients
+const (
+	SyncFrameHello = "hello" // First frame, with the client's last seen event UUID
+	SyncFramePush  = "push"  // A batch of new events from the client
+)
+
+// Sync frame types sent by the server
+const (
+	SyncFrameWelcome = "welcome" // Handshake accepted
+	SyncFrameEvents  = "events"  // Events the client has not seen yet
+	SyncFrameAck     = "ack"     // A pushed event was stored
+	SyncFrameReject  = "reject"  // A pushed event was not accepted
+	SyncFrameError   = "error"   // Protocol error; the server closes the connection
+)
+
+// SyncFrame is a single JSON message on the WebSocket sync connection
+type SyncFrame struct {
+	Version     int     `json:"v"`
+	Type        string  `json:"type"`
+	Id          string  `json:"id,omitempty"`          // Client-chosen push batch ID, echoed in ack/reject
+	User        string  `json:"user,omitempty"`        // Authenticated user, sent in welcome
+	LastEventId string  `json:"lastEventId,omitempty"` // Resume cursor, sent in hello
+	LastSeq     uint64  `json:"lastSeq,omitempty"`     // Alternative resume cursor, sent in hello
+	Events      []Event `json:"events,omitempty"`
+	EventUuid   string  `json:"eventUuid,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// NewSyncFrame creates a frame of the given type with the current protocol version
+func NewSyncFrame(frameType string) SyncFrame {
+	return SyncFrame{
+		Version: SyncProtocolVersion,
+		Type:    frameType,
+	}
+}
@@ -44,68 +44,88 @@ func (s *AclService) loadRules() error {
 	return nil
 }
 
+// Refresh reloads ACL rules from storage, so rules stored through events
+// take effect immediately
+func (s *AclService) Refresh() error {
+	return s.loadRules()
+}
+
 // CheckPermission checks if a user has permission for an action on an item
 func (s *AclService) CheckPermission(user, item, action string) bool {
-	// Root user bypass
-	if user == ".root" {
+	decision := s.Explain(user, item, action)
+
+	switch decision.Reason {
+	case models.AclReasonRoot:
 		log.Printf("ACL: Root user %s bypass for %s on %s", user, action, item)
-		return true
+	case models.AclReasonDefault:
+		log.Printf("ACL: Deny by default for user=%s, item=%s, action=%s", user, item, action)
+	default:
+		log.Printf("ACL: Decision for user=%s, item=%s, action=%s: %v (rule: %s)", user, item, action, decision.Allowed, decision.Rules[0].Type)
+	}
+	return decision.Allowed
+}
+
+// Explain evaluates a permission check and returns the decision together
+// with every matching rule, ordered so the deciding rule comes first
+func (s *AclService) Explain(user, item, action string) models.AclDecision {
+	decision := models.AclDecision{
+		User:   user,
+		Item:   item,
+		Action: action,
+		Rules:  []models.AclRuleMatch{},
+	}
+
+	// Root user bypass
+	if user == RootUserId {
+		decision.Allowed = true
+		decision.Reason = models.AclReasonRoot
+		return decision
 	}
 
 	s.mutex.RLock()
 	rules := s.rules
 	s.mutex.RUnlock()
 
-	// Find applicable rules
-	var applicableRules []models.AclRule
-	for _, rule := range rules {
+	// Find applicable rules. Rules are stored oldest first, so collect them
+	// newest first for the stable sort to break ties by recency.
+	for i := len(rules) - 1; i >= 0; i-- {
+		rule := rules[i]
 		if s.matches(rule.User, user) && s.matches(rule.Item, item) && s.matches(rule.Action, action) {
-			applicableRules = append(applicableRules, rule)
+			decision.Rules = append(decision.Rules, models.AclRuleMatch{
+				AclRule:           rule,
+				ItemSpecificity:   calculateSpecificity(rule.Item),
+				UserSpecificity:   calculateSpecificity(rule.User),
+				ActionSpecificity: calculateSpecificity(rule.Action),
+			})
 		}
 	}
 
-	if len(applicableRules) == 0 {
-		log.Printf("ACL: Deny by default for user=%s, item=%s, action=%s", user, item, action)
-		return false // Deny by default
+	if len(decision.Rules) == 0 {
+		decision.Reason = models.AclReasonDefault
+		return decision // Deny by default
 	}
 
-	// Sort by specificity (hierarchical: item > user > action > existing order)
-	sort.Slice(applicableRules, func(i, j int) bool {
-		itemI := calculateSpecificity(applicableRules[i].Item)
-		itemJ := calculateSpecificity(applicableRules[j].Item)
-		if itemI != itemJ {
-			return itemI > itemJ
+	// Sort by specificity (hierarchical: item > user > action > most recent)
+	applicableRules := decision.Rules
+	sort.SliceStable(applicableRules, func(i, j int) bool {
+		if applicableRules[i].ItemSpecificity != applicableRules[j].ItemSpecificity {
+			return applicableRules[i].ItemSpecificity > applicableRules[j].ItemSpecificity
 		}
-		userI := calculateSpecificity(applicableRules[i].User)
-		userJ := calculateSpecificity(applicableRules[j].User)
-		if userI != userJ {
-			return userI > userJ
+		if applicableRules[i].UserSpecificity != applicableRules[j].UserSpecificity {
+			return applicableRules[i].UserSpecificity > applicableRules[j].UserSpecificity
 		}
-		actionI := calculateSpecificity(applicableRules[i].Action)
-		actionJ := calculateSpecificity(applicableRules[j].Action)
-		if actionI != actionJ {
-			return actionI > actionJ
-		}
-		// Fallback to using the most recent rule
-		return i > j
+		return applicableRules[i].ActionSpecificity > applicableRules[j].ActionSpecificity
 	})
 
 	// The first (highest specificity/latest) determines
-	allowed := applicableRules[0].Type == "allow"
-	log.Printf("ACL: Decision for user=%s, item=%s, action=%s: %v (rule: %s)", user, item, action, allowed, applicableRules[0].Type)
-	return allowed
+	decision.Allowed = applicableRules[0].Type == "allow"
+	decision.Reason = models.AclReasonRule
+	return decision
 }
 
 // matches checks if pattern matches value (supports wildcards)
 func (s *AclService) matches(pattern, value string) bool {
-	if pattern == "*" {
-		return true
-	}
-	if strings.HasSuffix(pattern, "*") {
-		prefix := strings.TrimSuffix(pattern, "*")
-		return strings.HasPrefix(value, prefix)
-	}
-	return pattern == value
+	return models.MatchesPattern(pattern, value)
 }
 
 // AddRule adds a new ACL rule
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"simple-sync/src/models"
+)
+
+const (
+	// DefaultAuthCacheTTL bounds how long a validated key is trusted without
+	// checking storage, e.g. after it is deleted by another process
+	DefaultAuthCacheTTL = time.Minute
+	// DefaultAuthCacheMaxEntries bounds the memory used by the cache
+	DefaultAuthCacheMaxEntries = 10000
+)
+
+// authCacheKey is the keyed hash of a presented API key
+type authCacheKey [sha256.Size]byte
+
+// authCacheEntry is a successful validation result
+type authCacheEntry struct {
+	apiKey    models.ApiKey
+	expiresAt time.Time
+}
+
+// AuthCache caches successful API key validations so that the bcrypt hash
+// does not have to be checked on every request. Entries are keyed on an HMAC
+// of the presented key with a random per-process secret, so plain keys are
+// never held in memory.
+type AuthCache struct {
+	ttl        time.Duration
+	maxEntries int
+	secret     []byte
+
+	entries map[authCacheKey]authCacheEntry
+	// generation is incremented by every invalidation, so a validation that
+	// raced with a revocation is not cached
+	generation uint64
+	mutex      sync.Mutex
+}
+
+// NewAuthCache creates a cache holding up to maxEntries results for ttl
+func NewAuthCache(ttl time.Duration, maxEntries int) *AuthCache {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("failed to generate auth cache secret: " + err.Error())
+	}
+	return &AuthCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		secret:     secret,
+		entries:    make(map[authCacheKey]authCacheEntry),
+	}
+}
+
+// hash computes the cache key for a presented API key
+func (c *AuthCache) hash(apiKey string) authCacheKey {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(apiKey))
+	var key authCacheKey
+	copy(key[:], mac.Sum(nil))
+	return key
+}
+
+// Get returns the stored key for a cached API key, if present and not expired
+func (c *AuthCache) Get(apiKey string) (*models.ApiKey, bool) {
+	key := c.hash(apiKey)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	apiKeyModel := entry.apiKey
+	return &apiKeyModel, true
+}
+
+// Generation returns the current invalidation generation. Pass it to Set
+// after validating a key against storage.
+func (c *AuthCache) Generation() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+// Set caches a successful validation, unless an invalidation ran since
+// generation was read
+func (c *AuthCache) Set(apiKey string, apiKeyModel *models.ApiKey, generation uint64) {
+	key := c.hash(apiKey)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[key] = authCacheEntry{
+		apiKey:    *apiKeyModel,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
+
+// evict makes room for a new entry, dropping expired entries first and
+// otherwise the entry closest to expiring. Must be called with the mutex held.
+func (c *AuthCache) evict() {
+	now := time.Now()
+	var oldestKey authCacheKey
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest.IsZero() || entry.expiresAt.Before(oldest) {
+			oldestKey = key
+			oldest = entry.expiresAt
+		}
+	}
+	if len(c.entries) >= c.maxEntries {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// InvalidateUser removes every cached key belonging to a user
+func (c *AuthCache) InvalidateUser(userID string) {
+	c.invalidate(func(entry authCacheEntry) bool { return entry.apiKey.User == userID })
+}
+
+// InvalidateKey removes a single cached key by its UUID
+func (c *AuthCache) InvalidateKey(keyUUID string) {
+	c.invalidate(func(entry authCacheEntry) bool { return entry.apiKey.UUID == keyUUID })
+}
+
+// invalidate removes matching entries and bumps the generation
+func (c *AuthCache) invalidate(match func(authCacheEntry) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	for key, entry := range c.entries {
+		if match(entry) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Len returns the number of cached entries
+func (c *AuthCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
@@ -16,74 +15,192 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// DefaultRotationGracePeriod is how long old keys stay valid after a
+	// rotating key reset when no grace period is given
+	DefaultRotationGracePeriod = 24 * time.Hour
+	// MaxRotationGracePeriod bounds how long old keys can stay valid
+	MaxRotationGracePeriod = 30 * 24 * time.Hour
+
+	// DefaultSetupTokenTTL is how long setup tokens are valid when no TTL is given
+	DefaultSetupTokenTTL = 24 * time.Hour
+	// MinSetupTokenTTL and MaxSetupTokenTTL bound the TTL of setup tokens
+	MinSetupTokenTTL = time.Minute
+	MaxSetupTokenTTL = 7 * 24 * time.Hour
+	// MaxSetupTokenUses bounds how many API keys a setup token can be exchanged for
+	MaxSetupTokenUses = 100
+)
+
 // AuthService handles authentication operations
 type AuthService struct {
-	storage         storage.Storage
-	validationMutex sync.Mutex
+	storage storage.Storage
+	cache   *AuthCache
+	// exchangeMutex serializes setup token exchanges, so a token is never
+	// exchanged more often than it allows
+	exchangeMutex sync.Mutex
 }
 
-// NewAuthService creates a new auth service
+// NewAuthService creates a new auth service with the default validation cache
 func NewAuthService(storage storage.Storage) *AuthService {
+	return NewAuthServiceWithCache(storage, NewAuthCache(DefaultAuthCacheTTL, DefaultAuthCacheMaxEntries))
+}
+
+// NewAuthServiceWithCache creates a new auth service using the given
+// validation cache. A nil cache disables caching.
+func NewAuthServiceWithCache(storage storage.Storage, cache *AuthCache) *AuthService {
 	return &AuthService{
 		storage: storage,
+		cache:   cache,
 	}
 }
 
 // ValidateApiKey validates an API key and returns the associated user ID
 func (s *AuthService) ValidateApiKey(apiKey string) (string, error) {
-	s.validationMutex.Lock()
-	defer s.validationMutex.Unlock()
+	apiKeyModel, err := s.AuthenticateApiKey(apiKey)
+	if err != nil {
+		return "", err
+	}
+	return apiKeyModel.User, nil
+}
 
+// AuthenticateApiKey validates an API key and returns the stored key, including
+// its user and scopes. Cached results skip storage, so LastUsedAt is only
+// updated on cache misses.
+func (s *AuthService) AuthenticateApiKey(apiKey string) (*models.ApiKey, error) {
 	// Validate API key format before expensive operations
-	if len(apiKey) < 3 || apiKey[:3] != "sk_" {
-		return "", apperrors.ErrInvalidApiKeyFormat
+	keyId, err := utils.ParseApiKey(apiKey)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if the remaining part is valid base64 (try with padding since keys are truncated)
-	base64Part := apiKey[3:]
-	// Try decoding as-is first
-	if _, err := base64.StdEncoding.DecodeString(base64Part); err != nil {
-		// Try with padding added (generated keys are truncated to 43 chars)
-		if _, err := base64.StdEncoding.DecodeString(base64Part + "="); err != nil {
-			return "", apperrors.ErrInvalidApiKeyFormat
+	// Skip the hash comparison for recently validated keys
+	var generation uint64
+	if s.cache != nil {
+		if apiKeyModel, ok := s.cache.Get(apiKey); ok {
+			if apiKeyModel.IsExpired() {
+				return nil, apperrors.ErrApiKeyExpired
+			}
+			return apiKeyModel, nil
 		}
+		generation = s.cache.Generation()
 	}
 
-	// Get all API keys and find the one that matches
-	apiKeys, err := s.storage.GetAllApiKeys()
-	if err != nil {
-		return "", fmt.Errorf("failed to retrieve API keys: %w", err)
+	// Keys with an ID have a single candidate, so only one hash is compared
+	var candidates []*models.ApiKey
+	if keyId != "" {
+		apiKeyModel, err := s.storage.GetApiKeyByKeyId(keyId)
+		if err == storage.ErrApiKeyNotFound {
+			return nil, apperrors.ErrInvalidApiKey
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve API key: %w", err)
+		}
+		candidates = append(candidates, apiKeyModel)
+	} else {
+		// Legacy keys have no ID and must be compared against every legacy hash
+		candidates, err = s.storage.GetLegacyApiKeys()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve API keys: %w", err)
+		}
 	}
 
-	for _, apiKeyModel := range apiKeys {
+	for _, apiKeyModel := range candidates {
 		if bcrypt.CompareHashAndPassword([]byte(apiKeyModel.KeyHash), []byte(apiKey)) == nil {
-			// Update last used timestamp asynchronously to avoid blocking authentication
-			// Create a copy to avoid race conditions (manual copy to avoid mutex issues)
-			keyCopy := &models.ApiKey{
-				UUID:        apiKeyModel.UUID,
-				User:        apiKeyModel.User,
-				KeyHash:     apiKeyModel.KeyHash,
-				CreatedAt:   apiKeyModel.CreatedAt,
-				LastUsedAt:  apiKeyModel.LastUsedAt,
-				Description: apiKeyModel.Description,
+			if apiKeyModel.IsExpired() {
+				return nil, apperrors.ErrApiKeyExpired
 			}
+			if keyId == "" {
+				log.Printf("Auth: legacy API key %s used by %s, reset the key to upgrade it", apiKeyModel.UUID, apiKeyModel.User)
+			}
+
+			// Update last used timestamp asynchronously to avoid blocking authentication
+			// Copy the key so the update does not race with other readers
+			keyCopy := *apiKeyModel
 			go func() {
 				keyCopy.UpdateLastUsed()
-				if err := s.storage.UpdateApiKey(keyCopy); err != nil {
+				if err := s.storage.UpdateApiKey(&keyCopy); err != nil {
 					log.Printf("failed to update API key last used: %v", err)
 				}
 			}()
-			return apiKeyModel.User, nil
+			if s.cache != nil {
+				s.cache.Set(apiKey, apiKeyModel, generation)
+			}
+			return apiKeyModel, nil
 		}
 	}
 
-	return "", apperrors.ErrInvalidApiKey
+	return nil, apperrors.ErrInvalidApiKey
+}
+
+// InvalidateUserApiKeys deletes all API keys of a user and removes them from
+// the validation cache
+func (s *AuthService) InvalidateUserApiKeys(userID string) error {
+	err := s.storage.InvalidateUserApiKeys(userID)
+	if s.cache != nil {
+		s.cache.InvalidateUser(userID)
+	}
+	return err
 }
 
-// GenerateApiKey generates a new API key for a user
+// RotateUserApiKeys issues a new API key for a user and makes all existing
+// keys of the user expire at oldKeysExpireAt, so clients can switch over
+// before the old keys stop working
+func (s *AuthService) RotateUserApiKeys(userID string, oldKeysExpireAt time.Time, description string, scopes []string) (*models.ApiKey, string, error) {
+	if err := models.ValidateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	// Expire the old keys first so the new key is not affected
+	err := s.storage.ExpireUserApiKeys(userID, oldKeysExpireAt)
+	if s.cache != nil {
+		s.cache.InvalidateUser(userID)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to expire API keys: %w", err)
+	}
+
+	return s.GenerateScopedApiKey(userID, description, scopes)
+}
+
+// RevokeApiKey deletes a single API key and removes it from the validation cache
+func (s *AuthService) RevokeApiKey(keyUUID string) error {
+	err := s.storage.DeleteApiKey(keyUUID)
+	if s.cache != nil {
+		s.cache.InvalidateKey(keyUUID)
+	}
+	return err
+}
+
+// GenerateApiKey generates a new unrestricted API key for a user
 func (s *AuthService) GenerateApiKey(userID, description string) (*models.ApiKey, string, error) {
+	return s.GenerateScopedApiKey(userID, description, nil)
+}
+
+// GenerateScopedApiKey generates a new API key for a user limited to scopes.
+// Empty scopes generate an unrestricted key.
+func (s *AuthService) GenerateScopedApiKey(userID, description string, scopes []string) (*models.ApiKey, string, error) {
+	apiKey, plainKey, err := newApiKey(userID, description, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Store the API key
+	err = s.storage.AddApiKey(apiKey)
+	if err != nil {
+		return nil, "", errors.New("failed to store API key")
+	}
+
+	return apiKey, plainKey, nil
+}
+
+// newApiKey creates an API key for a user without storing it
+func newApiKey(userID, description string, scopes []string) (*models.ApiKey, string, error) {
+	if err := models.ValidateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
 	// Generate a new API key
-	plainKey, err := utils.GenerateApiKey()
+	keyId, plainKey, err := utils.GenerateApiKey()
 	if err != nil {
 		return nil, "", errors.New("failed to generate API key")
 	}
@@ -96,20 +213,27 @@ func (s *AuthService) GenerateApiKey(userID, description string) (*models.ApiKey
 
 	// Create API key model
 	apiKey := models.NewApiKey(userID, string(keyHash), description)
-
-	// Store the API key
-	err = s.storage.AddApiKey(apiKey)
-	if err != nil {
-		return nil, "", errors.New("failed to store API key")
-	}
+	apiKey.KeyId = keyId
+	apiKey.Scopes = scopes
 
 	return apiKey, plainKey, nil
 }
 
 // GenerateSetupToken generates a new setup token for a user
 func (s *AuthService) GenerateSetupToken(userID string) (*models.SetupToken, error) {
+	return s.GenerateSetupTokenWithOptions(userID, models.SetupTokenOptions{})
+}
+
+// GenerateSetupTokenWithOptions generates a new setup token for a user,
+// configured by options
+func (s *AuthService) GenerateSetupTokenWithOptions(userID string, options models.SetupTokenOptions) (*models.SetupToken, error) {
+	setupToken, err := newSetupToken(userID, options)
+	if err != nil {
+		return nil, err
+	}
+
 	// Verify user exists
-	_, err := s.storage.GetUserById(userID)
+	_, err = s.storage.GetUserById(userID)
 	if err != nil {
 		if err == storage.ErrNotFound {
 			return nil, apperrors.ErrUserNotFound
@@ -123,17 +247,46 @@ func (s *AuthService) GenerateSetupToken(userID string) (*models.SetupToken, err
 		return nil, errors.New("failed to invalidate existing tokens")
 	}
 
-	// Generate a new token
-	token, err := utils.GenerateToken()
+	// Store the setup token
+	err = s.storage.AddSetupToken(setupToken)
 	if err != nil {
-		return nil, errors.New("failed to generate setup token")
+		return nil, errors.New("failed to store setup token")
 	}
 
-	// Create setup token model
-	expiresAt := time.Now().Add(24 * time.Hour)
-	setupToken := models.NewSetupToken(token, userID, expiresAt)
+	return setupToken, nil
+}
 
-	// Store the setup token
+// GenerateInvitation creates an invitation token for a user that does not
+// exist yet. Its first exchange creates the user and installs the given ACL
+// rules on behalf of the inviter.
+func (s *AuthService) GenerateInvitation(inviterID, userID string, aclRules []models.AclRule, options models.SetupTokenOptions) (*models.SetupToken, error) {
+	setupToken, err := newSetupToken(userID, options)
+	if err != nil {
+		return nil, err
+	}
+	setupToken.Invitation = true
+	setupToken.AclRules = aclRules
+	setupToken.CreatedBy = inviterID
+	if err := setupToken.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The user is only created on exchange, so it must not exist yet
+	_, err = s.storage.GetUserById(userID)
+	if err == nil {
+		return nil, storage.ErrUserExists
+	}
+	if err != storage.ErrNotFound {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Invalidate any earlier invitations for the same user
+	err = s.storage.InvalidateUserSetupTokens(userID)
+	if err != nil {
+		return nil, errors.New("failed to invalidate existing tokens")
+	}
+
+	// Store the invitation
 	err = s.storage.AddSetupToken(setupToken)
 	if err != nil {
 		return nil, errors.New("failed to store setup token")
@@ -142,31 +295,92 @@ func (s *AuthService) GenerateSetupToken(userID string) (*models.SetupToken, err
 	return setupToken, nil
 }
 
+// newSetupToken validates the options and creates a setup token for a user
+// without storing it
+func newSetupToken(userID string, options models.SetupTokenOptions) (*models.SetupToken, error) {
+	if err := models.ValidateScopes(options.Scopes); err != nil {
+		return nil, err
+	}
+	ttl := options.TTL
+	if ttl == 0 {
+		ttl = DefaultSetupTokenTTL
+	}
+	if ttl < MinSetupTokenTTL || ttl > MaxSetupTokenTTL {
+		return nil, apperrors.ErrInvalidTokenTTL
+	}
+	maxUses := options.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	if maxUses < 1 || maxUses > MaxSetupTokenUses {
+		return nil, apperrors.ErrInvalidMaxUses
+	}
+
+	// Generate a new token
+	generate := utils.GenerateToken
+	if options.Long {
+		generate = utils.GenerateLongToken
+	}
+	token, err := generate()
+	if err != nil {
+		return nil, errors.New("failed to generate setup token")
+	}
+
+	// Create setup token model
+	setupToken := models.NewSetupToken(token, userID, time.Now().Add(ttl))
+	setupToken.Scopes = options.Scopes
+	setupToken.MaxUses = maxUses
+
+	return setupToken, nil
+}
+
 // ExchangeSetupToken exchanges a setup token for an API key
 func (s *AuthService) ExchangeSetupToken(token, description string) (*models.ApiKey, string, error) {
+	apiKey, plainKey, _, err := s.RedeemSetupToken(token, description)
+	return apiKey, plainKey, err
+}
+
+// RedeemSetupToken exchanges a setup token for an API key like
+// ExchangeSetupToken. The first exchange of an invitation also creates its
+// user and ACL rules; the internal events doing so are stored together with
+// the key and returned.
+func (s *AuthService) RedeemSetupToken(token, description string) (*models.ApiKey, string, []models.Event, error) {
+	s.exchangeMutex.Lock()
+	defer s.exchangeMutex.Unlock()
+
 	// Get the setup token
 	setupToken, err := s.storage.GetSetupToken(token)
 	if err != nil {
-		return nil, "", apperrors.ErrInvalidSetupToken
+		return nil, "", nil, apperrors.ErrInvalidSetupToken
 	}
 
 	// Validate the token
 	if !setupToken.IsValid() {
-		return nil, "", apperrors.ErrSetupTokenExpired
+		return nil, "", nil, apperrors.ErrSetupTokenExpired
 	}
 
-	// Mark the token as used
-	setupToken.MarkUsed()
-	err = s.storage.UpdateSetupToken(setupToken)
+	// Generate API key for the user
+	apiKey, plainKey, err := newApiKey(setupToken.User, description, setupToken.Scopes)
 	if err != nil {
-		return nil, "", errors.New("failed to update setup token")
+		return nil, "", nil, err
 	}
 
-	// Generate API key for the user
-	apiKey, plainKey, err := s.GenerateApiKey(setupToken.User, description)
+	var events []models.Event
+	if setupToken.Invitation && setupToken.UseCount == 0 {
+		events, err = setupToken.InvitationEvents()
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	// Mark the token as used and store everything at once
+	err = s.storage.RedeemSetupToken(token, events, apiKey)
+	if err == storage.ErrSetupTokenNotFound {
+		return nil, "", nil, apperrors.ErrSetupTokenExpired
+	}
 	if err != nil {
-		return nil, "", err
+		return nil, "", nil, fmt.Errorf("failed to redeem setup token: %w", err)
 	}
 
-	return apiKey, plainKey, nil
+	return apiKey, plainKey, events, nil
 }
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	apperrors "simple-sync/src/errors"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+)
+
+// RootUserId is the user that bypasses all ACL checks
+const RootUserId = ".root"
+
+// BootstrapRootApiKey creates the root user of a fresh server and issues its
+// first API key. Fails with ErrAlreadyBootstrapped if the root user exists.
+func (s *AuthService) BootstrapRootApiKey(description string) (*models.ApiKey, string, error) {
+	apiKey, plainKey, err := newApiKey(RootUserId, description, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.bootstrap(apiKey, nil); err != nil {
+		return nil, "", err
+	}
+	return apiKey, plainKey, nil
+}
+
+// BootstrapRootSetupToken creates the root user of a fresh server and a setup
+// token for it, so the first API key never has to be printed. Fails with
+// ErrAlreadyBootstrapped if the root user exists.
+func (s *AuthService) BootstrapRootSetupToken(options models.SetupTokenOptions) (*models.SetupToken, error) {
+	setupToken, err := newSetupToken(RootUserId, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.bootstrap(nil, setupToken); err != nil {
+		return nil, err
+	}
+	return setupToken, nil
+}
+
+// bootstrap stores the .user.create event of the root user together with its
+// first credential. Storage creates the user in the same transaction and
+// rejects the event if the user exists, so concurrent bootstraps cannot both
+// succeed, and a failed bootstrap leaves nothing behind to block a retry.
+func (s *AuthService) bootstrap(apiKey *models.ApiKey, setupToken *models.SetupToken) error {
+	event := models.NewEvent(RootUserId, ".user."+RootUserId, ".user.create", "{}")
+	err := s.storage.Bootstrap([]models.Event{*event}, apiKey, setupToken)
+	if errors.Is(err, storage.ErrUserExists) {
+		return apperrors.ErrAlreadyBootstrapped
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bootstrap root user: %w", err)
+	}
+	return nil
+}
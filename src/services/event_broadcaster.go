@@ -0,0 +1,70 @@
+package services
+
+import (
+	"log"
+	"sync"
+
+	"simple-sync/src/models"
+)
+
+// subscriberBufferSize is the number of events a subscriber can fall behind
+// before it is dropped
+const subscriberBufferSize = 256
+
+// EventBroadcaster fans out newly committed events to in-process subscribers
+type EventBroadcaster struct {
+	subscribers map[chan models.Event]struct{}
+	mutex       sync.Mutex
+}
+
+// NewEventBroadcaster creates a new event broadcaster
+func NewEventBroadcaster() *EventBroadcaster {
+	return &EventBroadcaster{
+		subscribers: make(map[chan models.Event]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber and returns its event channel.
+// The channel is closed when the subscriber is dropped for falling behind
+// or when Unsubscribe is called.
+func (b *EventBroadcaster) Subscribe() chan models.Event {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ch := make(chan models.Event, subscriberBufferSize)
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (b *EventBroadcaster) Unsubscribe(ch chan models.Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.subscribers[ch]; exists {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish sends committed events to every subscriber without blocking.
+// Subscribers whose buffer is full are dropped so that a slow client cannot
+// stall writers; they are expected to reconnect and resume from their cursor.
+func (b *EventBroadcaster) Publish(events []models.Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+subscribers:
+	for ch := range b.subscribers {
+		for _, event := range events {
+			select {
+			case ch <- event:
+			default:
+				log.Printf("EventBroadcaster: dropping slow subscriber")
+				delete(b.subscribers, ch)
+				close(ch)
+				continue subscribers
+			}
+		}
+	}
+}
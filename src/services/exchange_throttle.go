@@ -0,0 +1,211 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// ThrottleLimits configures how failed attempts lead to lockouts
+type ThrottleLimits struct {
+	FreeFailures int           // Failures allowed before lockouts start
+	BaseLockout  time.Duration // Lockout after the first failure past FreeFailures, doubled for each further failure
+	MaxLockout   time.Duration // Upper bound for a single lockout
+	ResetAfter   time.Duration // Failures are forgotten after this long without a new one
+}
+
+var (
+	// DefaultClientThrottleLimits apply to the failed attempts of a single client IP
+	DefaultClientThrottleLimits = ThrottleLimits{
+		FreeFailures: 5,
+		BaseLockout:  time.Second,
+		MaxLockout:   15 * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+	// DefaultGlobalThrottleLimits apply to the failed attempts of all clients
+	// together, bounding guessing spread over many IPs. The lockout is kept
+	// short since it also blocks legitimate clients.
+	DefaultGlobalThrottleLimits = ThrottleLimits{
+		FreeFailures: 50,
+		BaseLockout:  time.Second,
+		MaxLockout:   time.Minute,
+		ResetAfter:   10 * time.Minute,
+	}
+)
+
+// maxThrottledClients bounds the memory used for tracking client IPs
+const maxThrottledClients = 10000
+
+// throttleState tracks the recent failures of a client or of all clients
+type throttleState struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+	inFlight    int // Attempts allowed whose outcome is not known yet
+}
+
+// wait returns how long a new attempt has to wait. Attempts in flight count
+// as failures, so once they could use up the free failures only one attempt
+// runs at a time and the next one waits for its outcome.
+func (s *throttleState) wait(limits ThrottleLimits, now time.Time) time.Duration {
+	if now.Before(s.lockedUntil) {
+		return s.lockedUntil.Sub(now)
+	}
+	failures := s.failures
+	if now.Sub(s.lastFailure) > limits.ResetAfter {
+		failures = 0
+	}
+	if s.inFlight > 0 && failures+s.inFlight >= limits.FreeFailures {
+		return limits.BaseLockout
+	}
+	return 0
+}
+
+// release ends an attempt in flight
+func (s *throttleState) release() {
+	if s.inFlight > 0 {
+		s.inFlight--
+	}
+}
+
+// fail records a failed attempt and returns the resulting lockout
+func (s *throttleState) fail(limits ThrottleLimits, now time.Time) time.Duration {
+	if now.Sub(s.lastFailure) > limits.ResetAfter {
+		s.failures = 0
+	}
+	s.failures++
+	s.lastFailure = now
+
+	excess := s.failures - limits.FreeFailures
+	if excess <= 0 {
+		return 0
+	}
+	lockout := limits.MaxLockout
+	// Avoid overflowing the shift for long runs of failures
+	if excess <= 32 {
+		lockout = min(limits.BaseLockout<<(excess-1), limits.MaxLockout)
+	}
+	s.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// ExchangeThrottle limits failed setup token exchanges per client IP and
+// globally, locking out clients for exponentially longer after repeated
+// failures
+type ExchangeThrottle struct {
+	clientLimits ThrottleLimits
+	globalLimits ThrottleLimits
+
+	clients map[string]*throttleState
+	global  throttleState
+	mutex   sync.Mutex
+}
+
+// NewExchangeThrottle creates a throttle with the given per-client and global limits
+func NewExchangeThrottle(clientLimits, globalLimits ThrottleLimits) *ExchangeThrottle {
+	return &ExchangeThrottle{
+		clientLimits: clientLimits,
+		globalLimits: globalLimits,
+		clients:      make(map[string]*throttleState),
+	}
+}
+
+// Allow checks if a client may attempt an exchange. If not, it returns how
+// long the client has to wait. An allowed attempt is reserved until its
+// outcome is reported with Failure, Success or Release, so concurrent
+// attempts cannot get more guesses than attempts made one after another.
+func (t *ExchangeThrottle) Allow(clientIP string) (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	client := t.client(clientIP, now)
+	if wait := max(client.wait(t.clientLimits, now), t.global.wait(t.globalLimits, now)); wait > 0 {
+		return wait, false
+	}
+	client.inFlight++
+	t.global.inFlight++
+	return 0, true
+}
+
+// Failure records a failed exchange by a client and returns the number of
+// recent failures of the client and how long it is now locked out
+func (t *ExchangeThrottle) Failure(clientIP string) (int, time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	client := t.client(clientIP, now)
+	client.release()
+	t.global.release()
+
+	lockout := max(client.fail(t.clientLimits, now), t.global.fail(t.globalLimits, now))
+	return client.failures, lockout
+}
+
+// Success forgets the failures of a client after a successful exchange
+func (t *ExchangeThrottle) Success(clientIP string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.global.release()
+	if client, exists := t.clients[clientIP]; exists {
+		client.release()
+		if client.inFlight == 0 {
+			delete(t.clients, clientIP)
+		} else {
+			client.failures = 0
+			client.lockedUntil = time.Time{}
+		}
+	}
+}
+
+// Release ends an attempt that neither failed nor succeeded, such as one
+// that ran into an internal error
+func (t *ExchangeThrottle) Release(clientIP string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.global.release()
+	if client, exists := t.clients[clientIP]; exists {
+		client.release()
+	}
+}
+
+// client returns the state of a client, adding it if needed. Must be called
+// with the mutex held.
+func (t *ExchangeThrottle) client(clientIP string, now time.Time) *throttleState {
+	client, exists := t.clients[clientIP]
+	if !exists {
+		if len(t.clients) >= maxThrottledClients {
+			t.prune(now)
+		}
+		client = &throttleState{}
+		t.clients[clientIP] = client
+	}
+	return client
+}
+
+// prune makes room for a new client, dropping clients whose failures have
+// been forgotten and otherwise the client with the oldest failure. Clients
+// with attempts in flight are kept. Must be called with the mutex held.
+func (t *ExchangeThrottle) prune(now time.Time) {
+	var oldestIP string
+	var oldest time.Time
+	for ip, client := range t.clients {
+		// Clients with attempts in flight are still needed to release them
+		if client.inFlight > 0 {
+			continue
+		}
+		if now.Sub(client.lastFailure) > t.clientLimits.ResetAfter && now.After(client.lockedUntil) {
+			delete(t.clients, ip)
+			continue
+		}
+		if oldestIP == "" || client.lastFailure.Before(oldest) {
+			oldestIP = ip
+			oldest = client.lastFailure
+		}
+	}
+	if len(t.clients) >= maxThrottledClients && oldestIP != "" {
+		delete(t.clients, oldestIP)
+	}
+}
@@ -3,8 +3,10 @@ package storage
 import (
 	"errors"
 	"log"
+	apperrors "simple-sync/src/errors"
 	"simple-sync/src/models"
 	"testing"
+	"time"
 )
 
 // Storage-specific error types
@@ -14,34 +16,74 @@ var (
 	ErrInvalidData        = errors.New("invalid data")
 	ErrApiKeyNotFound     = errors.New("API key not found")
 	ErrSetupTokenNotFound = errors.New("setup token not found")
+	ErrUserExists         = errors.New("user already exists")
 )
 
+// isEventRejection reports whether err rejects a single submitted event,
+// rather than being a failure of the storage itself
+func isEventRejection(err error) bool {
+	return errors.Is(err, ErrDuplicateKey) || errors.Is(err, ErrUserExists) || errors.Is(err, apperrors.ErrInvalidUserItem)
+}
+
 // Storage defines the interface for data persistence
 type Storage interface {
 	// Event operations
+	// AddEvents stores events atomically. Users created by .user.create events
+	// are stored in the same transaction (ErrUserExists if one already exists).
 	AddEvents(events []models.Event) error
+	// SubmitEvents stores events submitted by clients, which may be retried.
+	// An event identical to a stored one is a duplicate and is skipped, while
+	// a different event with the UUID of a stored one is rejected with
+	// ErrDuplicateKey. When atomic, the first rejection fails the whole batch
+	// with its error; otherwise the remaining events are still stored. The
+	// results are in the order of the events.
+	SubmitEvents(events []models.Event, atomic bool) ([]models.EventResult, error)
 	LoadEvents() ([]models.Event, error)
+	QueryEvents(query models.EventQuery) ([]models.Event, error)
 
 	// User operations
 	AddUser(user *models.User) error
 	GetUserById(id string) (*models.User, error)
+	// GetUsers retrieves all users, ordered by ID
+	GetUsers() ([]models.User, error)
 
 	// API Key operations
 	AddApiKey(apiKey *models.ApiKey) error
 	GetApiKeyByHash(hash string) (*models.ApiKey, error)
+	GetApiKeyByKeyId(keyId string) (*models.ApiKey, error)
+	GetApiKeyByUuid(uuid string) (*models.ApiKey, error)
+	// GetUserApiKeys returns the API keys of a user, oldest first
+	GetUserApiKeys(userID string) ([]*models.ApiKey, error)
+	// GetLegacyApiKeys returns the API keys created before keys had an ID
+	GetLegacyApiKeys() ([]*models.ApiKey, error)
 	GetAllApiKeys() ([]*models.ApiKey, error)
 	UpdateApiKey(apiKey *models.ApiKey) error
 	InvalidateUserApiKeys(userID string) error
+	// ExpireUserApiKeys makes all API keys of a user expire at expiresAt,
+	// keeping any earlier expiry
+	ExpireUserApiKeys(userID string, expiresAt time.Time) error
+	DeleteApiKey(uuid string) error
 
 	// Setup Token operations
 	AddSetupToken(token *models.SetupToken) error
 	GetSetupToken(token string) (*models.SetupToken, error)
 	UpdateSetupToken(token *models.SetupToken) error
+	// RedeemSetupToken records a use of a setup token and atomically stores the
+	// events and API key issued for it. Returns ErrSetupTokenNotFound if the
+	// token has no uses left, and ErrUserExists like AddEvents.
+	RedeemSetupToken(token string, events []models.Event, apiKey *models.ApiKey) error
+	// Bootstrap atomically stores the events creating the root user together
+	// with its first credential, which is either an API key or a setup token.
+	// Returns ErrUserExists like AddEvents.
+	Bootstrap(events []models.Event, apiKey *models.ApiKey, setupToken *models.SetupToken) error
 	InvalidateUserSetupTokens(userID string) error
 
 	// ACL operations
 	AddAclRule(rule *models.AclRule) error
 	GetAclRules() ([]models.AclRule, error)
+	// GetAclRuleRecords returns the current ACL rules, oldest first, with the
+	// event that created each one
+	GetAclRuleRecords() ([]models.AclRuleRecord, error)
 }
 
 // NewStorage creates a new storage instance based on the current environment
@@ -58,3 +100,14 @@ func NewStorage() Storage {
 	}
 	return sqlite
 }
+
+// QueryEventPage loads one page of up to limit events matching a query. One
+// extra event is loaded to find out if there are more pages.
+func QueryEventPage(s Storage, query models.EventQuery, limit int) (*models.EventPage, error) {
+	query.Limit = limit + 1
+	events, err := s.QueryEvents(query)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewEventPage(events, query, limit), nil
+}
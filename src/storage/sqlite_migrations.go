@@ -3,10 +3,12 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+
+	"simple-sync/src/models"
 )
 
 // DesiredSchemaVersion is the latest schema version the app expects.
-const DesiredSchemaVersion = 1
+const DesiredSchemaVersion = 10
 
 // migrations holds per-version migration functions that bring the DB to that version.
 var migrations = map[int]func(tx *sql.Tx) error{
@@ -64,6 +66,217 @@ var migrations = map[int]func(tx *sql.Tx) error{
 		}
 		return nil
 	},
+	2: func(tx *sql.Tx) error {
+		// Backfill acl_rule from the ACL events stored before rules were
+		// materialised by AddEvents, replaying them in event order
+		stmts := []string{
+			`INSERT OR REPLACE INTO acl_rule (user, item, action, type)
+				SELECT json_extract(payload, '$.user'), json_extract(payload, '$.item'),
+					json_extract(payload, '$.action'), json_extract(payload, '$.type')
+				FROM event
+				WHERE item = '.acl' AND action = '.acl.addRule' AND json_valid(payload)
+					AND json_type(payload, '$.user') = 'text' AND json_type(payload, '$.item') = 'text'
+					AND json_type(payload, '$.action') = 'text' AND json_type(payload, '$.type') = 'text'
+				ORDER BY uuid;`,
+		}
+
+		for _, s := range stmts {
+			if _, err := tx.Exec(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	3: func(tx *sql.Tx) error {
+		// Record the .acl.addRule event that created each rule, backfilled
+		// from the most recent matching event
+		stmts := []string{
+			`ALTER TABLE acl_rule ADD COLUMN event_uuid TEXT;`,
+			`ALTER TABLE acl_rule ADD COLUMN event_user TEXT;`,
+			`ALTER TABLE acl_rule ADD COLUMN event_timestamp INTEGER;`,
+			`UPDATE acl_rule SET event_uuid = (
+				SELECT uuid FROM event
+				WHERE item = '.acl' AND action = '.acl.addRule' AND json_valid(payload)
+					AND json_extract(payload, '$.user') = acl_rule.user AND json_extract(payload, '$.item') = acl_rule.item
+					AND json_extract(payload, '$.action') = acl_rule.action AND json_extract(payload, '$.type') = acl_rule.type
+				ORDER BY uuid DESC LIMIT 1
+			);`,
+			`UPDATE acl_rule SET
+				event_user = (SELECT user FROM event WHERE uuid = acl_rule.event_uuid),
+				event_timestamp = (SELECT timestamp FROM event WHERE uuid = acl_rule.event_uuid)
+			WHERE event_uuid IS NOT NULL;`,
+		}
+
+		for _, s := range stmts {
+			if _, err := tx.Exec(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	4: func(tx *sql.Tx) error {
+		// Record the order rules were added in, used to break ties between
+		// rules of equal specificity. Existing rules keep their insertion order.
+		stmts := []string{
+			`ALTER TABLE acl_rule ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;`,
+			`UPDATE acl_rule SET seq = rowid;`,
+			`CREATE INDEX IF NOT EXISTS idx_acl_rule_seq ON acl_rule(seq);`,
+		}
+
+		for _, s := range stmts {
+			if _, err := tx.Exec(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	5: func(tx *sql.Tx) error {
+		// Keys with an ID are looked up directly instead of comparing every
+		// hash. Existing keys have no ID and remain valid as legacy keys.
+		stmts := []string{
+			`ALTER TABLE api_key ADD COLUMN key_id TEXT;`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_api_key_key_id ON api_key(key_id);`,
+		}
+
+		for _, s := range stmts {
+			if _, err := tx.Exec(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	6: func(tx *sql.Tx) error {
+		// Space separated scopes; existing keys and tokens stay unrestricted
+		stmts := []string{
+			`ALTER TABLE api_key ADD COLUMN scopes TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE setup_token ADD COLUMN scopes TEXT NOT NULL DEFAULT '';`,
+		}
+
+		for _, s := range stmts {
+			if _, err := tx.Exec(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	7: func(tx *sql.Tx) error {
+		// Existing keys never expire
+		_, err := tx.Exec(`ALTER TABLE api_key ADD COLUMN expires_at DATETIME;`)
+		return err
+	},
+	8: func(tx *sql.Tx) error {
+		// Existing tokens are single use; unused tokens store a zero used_at
+		stmts := []string{
+			`ALTER TABLE setup_token ADD COLUMN max_uses INTEGER NOT NULL DEFAULT 1;`,
+			`ALTER TABLE setup_token ADD COLUMN use_count INTEGER NOT NULL DEFAULT 0;`,
+			`UPDATE setup_token SET use_count = 1 WHERE used_at IS NOT NULL AND used_at NOT LIKE '0001-01-01%';`,
+		}
+
+		for _, s := range stmts {
+			if _, err := tx.Exec(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	9: func(tx *sql.Tx) error {
+		// Invitations are created before their user exists, so the table is
+		// rebuilt without the foreign key on user
+		stmts := []string{
+			`CREATE TABLE setup_token_new (
+				token TEXT PRIMARY KEY,
+				user TEXT NOT NULL,
+				expires_at DATETIME,
+				used_at DATETIME,
+				scopes TEXT NOT NULL DEFAULT '',
+				max_uses INTEGER NOT NULL DEFAULT 1,
+				use_count INTEGER NOT NULL DEFAULT 0,
+				invitation INTEGER NOT NULL DEFAULT 0,
+				acl_rules TEXT NOT NULL DEFAULT '',
+				created_by TEXT NOT NULL DEFAULT ''
+			);`,
+			`INSERT INTO setup_token_new (token, user, expires_at, used_at, scopes, max_uses, use_count)
+				SELECT token, user, expires_at, used_at, scopes, max_uses, use_count FROM setup_token;`,
+			`DROP TABLE setup_token;`,
+			`ALTER TABLE setup_token_new RENAME TO setup_token;`,
+		}
+
+		for _, s := range stmts {
+			if _, err := tx.Exec(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	10: func(tx *sql.Tx) error {
+		// Sequence numbers give the order of events stored within the same
+		// second. The sequence number is the rowid, so SQLite assigns it on
+		// insert, and AUTOINCREMENT keeps numbers from being reused. Existing
+		// events are numbered in the order they were loaded.
+		stmts := []string{
+			`CREATE TABLE event_new (
+				seq INTEGER PRIMARY KEY AUTOINCREMENT,
+				uuid TEXT NOT NULL UNIQUE,
+				timestamp INTEGER NOT NULL,
+				timestamp_ms INTEGER NOT NULL DEFAULT 0,
+				user TEXT NOT NULL,
+				item TEXT NOT NULL,
+				action TEXT NOT NULL,
+				payload TEXT
+			);`,
+			`INSERT INTO event_new (uuid, timestamp, user, item, action, payload)
+				SELECT uuid, timestamp, user, item, action, payload FROM event ORDER BY timestamp, rowid;`,
+			`DROP TABLE event;`,
+			`ALTER TABLE event_new RENAME TO event;`,
+			`CREATE INDEX IF NOT EXISTS idx_event_timestamp ON event(timestamp);`,
+			`CREATE INDEX IF NOT EXISTS idx_event_item ON event(item);`,
+		}
+
+		for _, s := range stmts {
+			if _, err := tx.Exec(s); err != nil {
+				return err
+			}
+		}
+
+		// Millisecond timestamps are taken from the event UUIDs, falling back
+		// to the second timestamp for UUIDs that do not encode it. There is no
+		// index, as range queries are narrowed by the second timestamp.
+		rows, err := tx.Query(`SELECT seq, uuid, timestamp FROM event`)
+		if err != nil {
+			return err
+		}
+		var events []models.Event
+		for rows.Next() {
+			var e models.Event
+			var ts int64
+			if err := rows.Scan(&e.Seq, &e.UUID, &ts); err != nil {
+				rows.Close()
+				return err
+			}
+			e.Timestamp = uint64(ts)
+			events = append(events, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		stmt, err := tx.Prepare(`UPDATE event SET timestamp_ms = ? WHERE seq = ?`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, e := range events {
+			timestampMs := e.UuidTimestampMs()
+			if timestampMs/1000 != e.Timestamp {
+				timestampMs = e.Timestamp * 1000
+			}
+			if _, err := stmt.Exec(int64(timestampMs), int64(e.Seq)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
 }
 
 func getUserVersion(db *sql.DB) (int, error) {
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
@@ -78,10 +79,10 @@ func (s *SQLiteStorage) Close() error {
 	if s.db == nil {
 		return nil
 	}
-	// Close DB and clear pointer
-	err := s.db.Close()
-	s.db = nil
-	if err != nil {
+	// The pointer is kept, so operations still running in the background,
+	// such as API key usage updates, fail with a closed database error
+	// instead of racing with Close
+	if err := s.db.Close(); err != nil {
 		return fmt.Errorf("failed to close db: %v", err)
 	}
 	return nil
@@ -101,24 +102,170 @@ func (s *SQLiteStorage) AddEvents(events []models.Event) error {
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare(`INSERT INTO event (uuid, timestamp, user, item, action, payload) VALUES (?, ?, ?, ?, ?, ?)`)
-	if err != nil {
+	if err := insertEvents(tx, events); err != nil {
 		tx.Rollback()
 		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SubmitEvents stores submitted events in a single transaction, skipping
+// events that were already stored
+func (s *SQLiteStorage) SubmitEvents(events []models.Event, atomic bool) ([]models.EventResult, error) {
+	if s.db == nil {
+		return nil, ErrInvalidData
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]models.EventResult, len(events))
+	for i := range events {
+		results[i] = models.EventResult{UUID: events[i].UUID, Status: models.EventStatusAccepted}
+		err := events[i].Validate()
+		if err == nil {
+			results[i].Status, err = submitEvent(tx, &events[i])
+			if err != nil && !isEventRejection(err) {
+				return nil, err
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if atomic {
+			return nil, err
+		}
+		results[i].Status = models.EventStatusRejected
+		results[i].Error = err.Error()
+		results[i].Err = err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// submitEvent stores a validated event within tx unless an identical event is
+// already stored. A savepoint undoes a partially applied event on failure.
+// The event is inserted before looking for a stored one, as a transaction that
+// reads first cannot start writing once another writer has committed.
+func submitEvent(tx *sql.Tx, e *models.Event) (string, error) {
+	if _, err := tx.Exec(`SAVEPOINT submit_event`); err != nil {
+		return models.EventStatusRejected, err
+	}
+	batch := []models.Event{*e}
+	if err := insertEvents(tx, batch); err != nil {
+		if _, rollbackErr := tx.Exec(`ROLLBACK TO submit_event`); rollbackErr != nil {
+			return models.EventStatusRejected, rollbackErr
+		}
+		if err == ErrDuplicateKey {
+			return duplicateEventStatus(tx, e)
+		}
+		return models.EventStatusRejected, err
+	}
+	e.Seq = batch[0].Seq
+	if _, err := tx.Exec(`RELEASE submit_event`); err != nil {
+		return models.EventStatusRejected, err
+	}
+	return models.EventStatusAccepted, nil
+}
+
+// duplicateEventStatus compares an event with the stored event of the same UUID
+func duplicateEventStatus(tx *sql.Tx, e *models.Event) (string, error) {
+	var existing models.Event
+	var ts int64
+	err := tx.QueryRow(`SELECT uuid, timestamp, timestamp_ms, user, item, action, payload, seq FROM event WHERE uuid = ?`, e.UUID).
+		Scan(&existing.UUID, &ts, &existing.TimestampMs, &existing.User, &existing.Item, &existing.Action, &existing.Payload, &existing.Seq)
+	if err == sql.ErrNoRows {
+		// The insert failed on a different constraint
+		return models.EventStatusRejected, ErrDuplicateKey
+	}
+	if err != nil {
+		return models.EventStatusRejected, err
+	}
+	existing.Timestamp = uint64(ts)
+	if existing.SameContent(e) {
+		return models.EventStatusDuplicate, nil
+	}
+	return models.EventStatusRejected, ErrDuplicateKey
+}
+
+// insertEvents stores validated events and applies internal events within tx.
+// SQLite assigns each event the next sequence number as its rowid, and the
+// millisecond timestamp is taken from the UUID if not given.
+func insertEvents(tx *sql.Tx, events []models.Event) error {
+	stmt, err := tx.Prepare(`INSERT INTO event (uuid, timestamp, timestamp_ms, user, item, action, payload) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
 	defer stmt.Close()
-	for _, e := range events {
-		if _, err := stmt.Exec(e.UUID, int64(e.Timestamp), e.User, e.Item, e.Action, e.Payload); err != nil {
-			tx.Rollback()
+	for i := range events {
+		e := &events[i]
+		if e.TimestampMs == 0 {
+			e.TimestampMs = e.UuidTimestampMs()
+		}
+		result, err := stmt.Exec(e.UUID, int64(e.Timestamp), int64(e.TimestampMs), e.User, e.Item, e.Action, e.Payload)
+		if err != nil {
 			// Map sqlite unique/constraint errors to ErrDuplicateKey
 			if strings.Contains(err.Error(), "UNIQUE") || strings.Contains(err.Error(), "constraint failed") {
 				return ErrDuplicateKey
 			}
 			return err
 		}
+		seq, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		e.Seq = uint64(seq)
+		if err := applyInternalEvent(tx, e); err != nil {
+			return err
+		}
 	}
-	if err := tx.Commit(); err != nil {
-		return err
+	return nil
+}
+
+// applyInternalEvent updates the tables derived from internal events within
+// the transaction that stores the event
+func applyInternalEvent(tx *sql.Tx, e *models.Event) error {
+	if e.IsUserCreateEvent() {
+		user, err := e.ToUser()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO user (id, created_at) VALUES (?, ?)`, user.Id, user.CreatedAt); err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") || strings.Contains(err.Error(), "constraint failed") {
+				return ErrUserExists
+			}
+			return err
+		}
+	}
+	if e.IsAclEvent() {
+		rule, err := e.ToAclRule()
+		if err != nil {
+			return err
+		}
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		switch e.Action {
+		case ".acl.addRule":
+			// Replacing moves an existing rule to the end, making it the most recent
+			_, err = tx.Exec(`INSERT OR REPLACE INTO acl_rule (user, item, action, type, event_uuid, event_user, event_timestamp, seq)
+				VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM acl_rule))`,
+				rule.User, rule.Item, rule.Action, rule.Type, e.UUID, e.User, int64(e.Timestamp))
+		case ".acl.removeRule":
+			_, err = tx.Exec(`DELETE FROM acl_rule WHERE user = ? AND item = ? AND action = ? AND type = ?`,
+				rule.User, rule.Item, rule.Action, rule.Type)
+		}
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -126,19 +273,17 @@ func (s *SQLiteStorage) LoadEvents() ([]models.Event, error) {
 	if s.db == nil {
 		return nil, ErrNotFound
 	}
-	rows, err := s.db.Query(`SELECT uuid, timestamp, user, item, action, payload FROM event ORDER BY timestamp ASC`)
+	rows, err := s.db.Query(`SELECT uuid, timestamp, timestamp_ms, user, item, action, payload, seq FROM event ORDER BY seq ASC`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var events []models.Event
 	for rows.Next() {
-		var e models.Event
-		var ts int64
-		if err := rows.Scan(&e.UUID, &ts, &e.User, &e.Item, &e.Action, &e.Payload); err != nil {
+		e, err := scanEvent(rows)
+		if err != nil {
 			return nil, err
 		}
-		e.Timestamp = uint64(ts)
 		events = append(events, e)
 	}
 	if err := rows.Err(); err != nil {
@@ -146,6 +291,101 @@ func (s *SQLiteStorage) LoadEvents() ([]models.Event, error) {
 	}
 	return events, nil
 }
+func (s *SQLiteStorage) QueryEvents(query models.EventQuery) ([]models.Event, error) {
+	if s.db == nil {
+		return nil, ErrNotFound
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"seq > ?"}
+	args := []any{int64(query.AfterSeq)}
+	if query.After != "" {
+		// An unknown UUID cursor is placed after the events with smaller UUIDs
+		conditions[0] = `seq > COALESCE((SELECT seq FROM event WHERE uuid = ?), (SELECT MAX(seq) FROM event WHERE uuid < ?), 0)`
+		args = []any{query.After, query.After}
+	}
+	for _, filter := range []struct{ column, pattern string }{
+		{"user", query.User},
+		{"item", query.Item},
+		{"action", query.Action},
+	} {
+		if condition, arg, ok := patternCondition(filter.column, filter.pattern); ok {
+			conditions = append(conditions, condition)
+			args = append(args, arg)
+		}
+	}
+	if query.From != 0 {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, int64(query.From))
+	}
+	if query.To != 0 {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, int64(query.To))
+	}
+	// Millisecond bounds also bound the indexed second timestamp
+	if query.FromMs != 0 {
+		conditions = append(conditions, "timestamp >= ?", "timestamp_ms >= ?")
+		args = append(args, int64(query.FromMs/1000), int64(query.FromMs))
+	}
+	if query.ToMs != 0 {
+		conditions = append(conditions, "timestamp <= ?", "timestamp_ms <= ?")
+		args = append(args, int64(query.ToMs/1000), int64(query.ToMs))
+	}
+
+	sqlQuery := `SELECT uuid, timestamp, timestamp_ms, user, item, action, payload, seq FROM event WHERE ` +
+		strings.Join(conditions, " AND ") + ` ORDER BY seq ASC`
+	if query.Limit > 0 {
+		sqlQuery += ` LIMIT ?`
+		args = append(args, query.Limit)
+	}
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]models.Event, 0)
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// patternCondition converts a filter pattern into a SQL condition on column.
+// Prefix wildcards use GLOB, which is case-sensitive like the ACL matching and
+// can use the column index. Returns ok=false when the pattern matches everything.
+func patternCondition(column, pattern string) (condition string, arg any, ok bool) {
+	if pattern == "" || pattern == "*" {
+		return "", nil, false
+	}
+	if prefix, found := strings.CutSuffix(pattern, "*"); found {
+		return column + " GLOB ?", globEscaper.Replace(prefix) + "*", true
+	}
+	return column + " = ?", pattern, true
+}
+
+// globEscaper escapes GLOB metacharacters so they match literally
+var globEscaper = strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]")
+
+// scanEvent reads a single event row selected as (uuid, timestamp, timestamp_ms, user, item, action, payload, seq)
+func scanEvent(rows *sql.Rows) (models.Event, error) {
+	var e models.Event
+	var ts int64
+	if err := rows.Scan(&e.UUID, &ts, &e.TimestampMs, &e.User, &e.Item, &e.Action, &e.Payload, &e.Seq); err != nil {
+		return e, err
+	}
+	e.Timestamp = uint64(ts)
+	return e, nil
+}
 func (s *SQLiteStorage) AddUser(user *models.User) error {
 	if s.db == nil {
 		return ErrInvalidData
@@ -191,6 +431,29 @@ func (s *SQLiteStorage) GetUserById(id string) (*models.User, error) {
 	}
 	return user, nil
 }
+
+// GetUsers retrieves all users, ordered by ID
+func (s *SQLiteStorage) GetUsers() ([]models.User, error) {
+	if s.db == nil {
+		return nil, ErrInvalidData
+	}
+
+	rows, err := s.db.Query(`SELECT id, created_at FROM user ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.Id, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
 func (s *SQLiteStorage) AddApiKey(apiKey *models.ApiKey) error {
 	if s.db == nil || apiKey == nil {
 		return ErrInvalidData
@@ -203,19 +466,8 @@ func (s *SQLiteStorage) AddApiKey(apiKey *models.ApiKey) error {
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	_, err = tx.Exec(`INSERT INTO api_key (uuid, user, key_hash, created_at, last_used_at, description) VALUES (?, ?, ?, ?, ?, ?)`,
-		apiKey.UUID, apiKey.User, apiKey.KeyHash, apiKey.CreatedAt, apiKey.LastUsedAt, apiKey.Description)
-	if err != nil {
+	if err := insertApiKey(tx, apiKey); err != nil {
 		tx.Rollback()
-		if strings.Contains(err.Error(), "UNIQUE") || strings.Contains(err.Error(), "constraint failed") {
-			return ErrDuplicateKey
-		}
 		return err
 	}
 
@@ -224,29 +476,52 @@ func (s *SQLiteStorage) AddApiKey(apiKey *models.ApiKey) error {
 	}
 	return nil
 }
-func (s *SQLiteStorage) GetApiKeyByHash(hash string) (*models.ApiKey, error) {
-	if s.db == nil {
-		return nil, ErrApiKeyNotFound
+
+// insertApiKey stores a validated API key within tx
+func insertApiKey(tx *sql.Tx, apiKey *models.ApiKey) error {
+	// Legacy keys have no ID and are stored with a NULL key_id
+	var keyId sql.NullString
+	if apiKey.KeyId != "" {
+		keyId = sql.NullString{String: apiKey.KeyId, Valid: true}
 	}
-	row := s.db.QueryRow(`SELECT uuid, user, key_hash, created_at, last_used_at, description FROM api_key WHERE key_hash = ?`, hash)
+	_, err := tx.Exec(`INSERT INTO api_key (uuid, key_id, user, key_hash, created_at, last_used_at, description, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		apiKey.UUID, keyId, apiKey.User, apiKey.KeyHash, apiKey.CreatedAt, apiKey.LastUsedAt, apiKey.Description, models.FormatScopes(apiKey.Scopes), apiKey.ExpiresAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") || strings.Contains(err.Error(), "constraint failed") {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+	return nil
+}
+
+// apiKeyColumns lists the api_key columns read by scanApiKey
+const apiKeyColumns = `uuid, key_id, user, key_hash, created_at, last_used_at, description, scopes, expires_at`
+
+// scanApiKey reads the apiKeyColumns of a single row into an API key
+func scanApiKey(row interface{ Scan(...any) error }) (*models.ApiKey, error) {
 	var k models.ApiKey
+	var keyId sql.NullString
 	var lastUsed sql.NullTime
-	if err := row.Scan(&k.UUID, &k.User, &k.KeyHash, &k.CreatedAt, &lastUsed, &k.Description); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrApiKeyNotFound
-		}
+	var scopes string
+	var expiresAt sql.NullTime
+	if err := row.Scan(&k.UUID, &keyId, &k.User, &k.KeyHash, &k.CreatedAt, &lastUsed, &k.Description, &scopes, &expiresAt); err != nil {
 		return nil, err
 	}
+	k.KeyId = keyId.String
+	k.Scopes = models.ParseScopes(scopes)
 	if lastUsed.Valid {
 		k.LastUsedAt = &lastUsed.Time
 	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
 	return &k, nil
 }
-func (s *SQLiteStorage) GetAllApiKeys() ([]*models.ApiKey, error) {
-	if s.db == nil {
-		return nil, ErrNotFound
-	}
-	rows, err := s.db.Query(`SELECT uuid, user, key_hash, created_at, last_used_at, description FROM api_key`)
+
+// queryApiKeys loads every API key returned by query
+func (s *SQLiteStorage) queryApiKeys(query string, args ...any) ([]*models.ApiKey, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -254,21 +529,82 @@ func (s *SQLiteStorage) GetAllApiKeys() ([]*models.ApiKey, error) {
 
 	var keys []*models.ApiKey
 	for rows.Next() {
-		var k models.ApiKey
-		var lastUsed sql.NullTime
-		if err := rows.Scan(&k.UUID, &k.User, &k.KeyHash, &k.CreatedAt, &lastUsed, &k.Description); err != nil {
+		k, err := scanApiKey(rows)
+		if err != nil {
 			return nil, err
 		}
-		if lastUsed.Valid {
-			k.LastUsedAt = &lastUsed.Time
-		}
-		keys = append(keys, &k)
+		keys = append(keys, k)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	return keys, nil
 }
+func (s *SQLiteStorage) GetApiKeyByHash(hash string) (*models.ApiKey, error) {
+	if s.db == nil {
+		return nil, ErrApiKeyNotFound
+	}
+	k, err := scanApiKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_key WHERE key_hash = ?`, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrApiKeyNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+// GetApiKeyByKeyId retrieves an API key by its public key ID using the key_id index
+func (s *SQLiteStorage) GetApiKeyByKeyId(keyId string) (*models.ApiKey, error) {
+	if s.db == nil {
+		return nil, ErrApiKeyNotFound
+	}
+	k, err := scanApiKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_key WHERE key_id = ?`, keyId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrApiKeyNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+// GetApiKeyByUuid retrieves an API key by its UUID
+func (s *SQLiteStorage) GetApiKeyByUuid(uuid string) (*models.ApiKey, error) {
+	if s.db == nil {
+		return nil, ErrApiKeyNotFound
+	}
+	k, err := scanApiKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_key WHERE uuid = ?`, uuid))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrApiKeyNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+// GetUserApiKeys retrieves the API keys of a user, oldest first
+func (s *SQLiteStorage) GetUserApiKeys(userID string) ([]*models.ApiKey, error) {
+	if s.db == nil {
+		return nil, ErrNotFound
+	}
+	return s.queryApiKeys(`SELECT `+apiKeyColumns+` FROM api_key WHERE user = ? ORDER BY created_at, uuid`, userID)
+}
+func (s *SQLiteStorage) GetAllApiKeys() ([]*models.ApiKey, error) {
+	if s.db == nil {
+		return nil, ErrNotFound
+	}
+	return s.queryApiKeys(`SELECT ` + apiKeyColumns + ` FROM api_key`)
+}
+
+// GetLegacyApiKeys retrieves all API keys without a key ID
+func (s *SQLiteStorage) GetLegacyApiKeys() ([]*models.ApiKey, error) {
+	if s.db == nil {
+		return nil, ErrNotFound
+	}
+	return s.queryApiKeys(`SELECT ` + apiKeyColumns + ` FROM api_key WHERE key_id IS NULL`)
+}
 func (s *SQLiteStorage) UpdateApiKey(apiKey *models.ApiKey) error {
 	if s.db == nil || apiKey == nil {
 		return ErrInvalidData
@@ -287,6 +623,37 @@ func (s *SQLiteStorage) InvalidateUserApiKeys(userID string) error {
 	_, err := s.db.Exec(`DELETE FROM api_key WHERE user = ?`, userID)
 	return err
 }
+
+// ExpireUserApiKeys sets the expiry of all API keys of a user to expiresAt,
+// unless a key already expires earlier
+func (s *SQLiteStorage) ExpireUserApiKeys(userID string, expiresAt time.Time) error {
+	if s.db == nil {
+		return ErrInvalidData
+	}
+
+	// A single statement, as a transaction that reads before writing cannot
+	// wait for concurrent writers. Expiry times are stored as text with a time
+	// zone, so they are compared with julianday.
+	_, err := s.db.Exec(`UPDATE api_key SET expires_at = ?
+		WHERE user = ? AND (expires_at IS NULL OR julianday(expires_at) > julianday(?))`,
+		expiresAt, userID, expiresAt)
+	return err
+}
+
+// DeleteApiKey deletes a single API key by UUID
+func (s *SQLiteStorage) DeleteApiKey(uuid string) error {
+	if s.db == nil {
+		return ErrInvalidData
+	}
+	result, err := s.db.Exec(`DELETE FROM api_key WHERE uuid = ?`, uuid)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrApiKeyNotFound
+	}
+	return nil
+}
 func (s *SQLiteStorage) AddSetupToken(token *models.SetupToken) error {
 	if s.db == nil || token == nil {
 		return ErrInvalidData
@@ -294,7 +661,26 @@ func (s *SQLiteStorage) AddSetupToken(token *models.SetupToken) error {
 	if err := token.Validate(); err != nil {
 		return err
 	}
-	_, err := s.db.Exec(`INSERT INTO setup_token (token, user, expires_at, used_at) VALUES (?, ?, ?, ?)`, token.Token, token.User, token.ExpiresAt, token.UsedAt)
+	return insertSetupToken(s.db, token)
+}
+
+// insertSetupToken stores a validated setup token using db, which is either
+// the database or a transaction
+func insertSetupToken(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, token *models.SetupToken) error {
+	// ACL rules are stored as a JSON array, or empty for tokens without rules
+	var aclRules string
+	if len(token.AclRules) > 0 {
+		rulesJson, err := json.Marshal(token.AclRules)
+		if err != nil {
+			return err
+		}
+		aclRules = string(rulesJson)
+	}
+	_, err := db.Exec(`INSERT INTO setup_token (token, user, expires_at, used_at, scopes, max_uses, use_count, invitation, acl_rules, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		token.Token, token.User, token.ExpiresAt, token.UsedAt, models.FormatScopes(token.Scopes), max(token.MaxUses, 1), token.UseCount,
+		token.Invitation, aclRules, token.CreatedBy)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE") || strings.Contains(err.Error(), "constraint failed") {
 			return ErrDuplicateKey
@@ -303,14 +689,16 @@ func (s *SQLiteStorage) AddSetupToken(token *models.SetupToken) error {
 	}
 	return nil
 }
+
 func (s *SQLiteStorage) GetSetupToken(token string) (*models.SetupToken, error) {
 	if s.db == nil {
 		return nil, ErrSetupTokenNotFound
 	}
-	row := s.db.QueryRow(`SELECT token, user, expires_at, used_at FROM setup_token WHERE token = ?`, token)
+	row := s.db.QueryRow(`SELECT token, user, expires_at, used_at, scopes, max_uses, use_count, invitation, acl_rules, created_by FROM setup_token WHERE token = ?`, token)
 	var st models.SetupToken
 	var used sql.NullTime
-	if err := row.Scan(&st.Token, &st.User, &st.ExpiresAt, &used); err != nil {
+	var scopes, aclRules string
+	if err := row.Scan(&st.Token, &st.User, &st.ExpiresAt, &used, &scopes, &st.MaxUses, &st.UseCount, &st.Invitation, &aclRules, &st.CreatedBy); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrSetupTokenNotFound
 		}
@@ -319,13 +707,99 @@ func (s *SQLiteStorage) GetSetupToken(token string) (*models.SetupToken, error)
 	if used.Valid {
 		st.UsedAt = used.Time
 	}
+	st.Scopes = models.ParseScopes(scopes)
+	if aclRules != "" {
+		if err := json.Unmarshal([]byte(aclRules), &st.AclRules); err != nil {
+			return nil, err
+		}
+	}
 	return &st, nil
 }
+
+// RedeemSetupToken records a use of a setup token and stores the events and
+// API key issued for it in a single transaction
+func (s *SQLiteStorage) RedeemSetupToken(token string, events []models.Event, apiKey *models.ApiKey) error {
+	if s.db == nil || apiKey == nil {
+		return ErrInvalidData
+	}
+	for i := range events {
+		if err := events[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if err := apiKey.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only count the use if the token has uses left, in case another process used it
+	result, err := tx.Exec(`UPDATE setup_token SET used_at = ?, use_count = use_count + 1 WHERE token = ? AND use_count < max_uses`, time.Now(), token)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSetupTokenNotFound
+	}
+
+	if err := insertEvents(tx, events); err != nil {
+		return err
+	}
+	if err := insertApiKey(tx, apiKey); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Bootstrap stores the events creating the root user and its first API key
+// or setup token in one transaction
+func (s *SQLiteStorage) Bootstrap(events []models.Event, apiKey *models.ApiKey, setupToken *models.SetupToken) error {
+	if s.db == nil || (apiKey == nil) == (setupToken == nil) {
+		return ErrInvalidData
+	}
+	for i := range events {
+		if err := events[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if apiKey != nil {
+		if err := apiKey.Validate(); err != nil {
+			return err
+		}
+	} else if err := setupToken.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertEvents(tx, events); err != nil {
+		return err
+	}
+	if apiKey != nil {
+		err = insertApiKey(tx, apiKey)
+	} else {
+		err = insertSetupToken(tx, setupToken)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 func (s *SQLiteStorage) UpdateSetupToken(token *models.SetupToken) error {
 	if s.db == nil || token == nil {
 		return ErrInvalidData
 	}
-	_, err := s.db.Exec(`UPDATE setup_token SET user = ?, expires_at = ?, used_at = ? WHERE token = ?`, token.User, token.ExpiresAt, token.UsedAt, token.Token)
+	_, err := s.db.Exec(`UPDATE setup_token SET user = ?, expires_at = ?, used_at = ?, use_count = ? WHERE token = ?`, token.User, token.ExpiresAt, token.UsedAt, token.UseCount, token.Token)
 	if err != nil {
 		return err
 	}
@@ -335,7 +809,7 @@ func (s *SQLiteStorage) InvalidateUserSetupTokens(userID string) error {
 	if s.db == nil {
 		return ErrInvalidData
 	}
-	_, err := s.db.Exec(`UPDATE setup_token SET used_at = ? WHERE user = ?`, time.Now(), userID)
+	_, err := s.db.Exec(`UPDATE setup_token SET used_at = ?, use_count = max_uses WHERE user = ?`, time.Now(), userID)
 	return err
 }
 func (s *SQLiteStorage) AddAclRule(rule *models.AclRule) error {
@@ -358,7 +832,7 @@ func (s *SQLiteStorage) AddAclRule(rule *models.AclRule) error {
 		}
 	}()
 
-	_, err = tx.Exec(`INSERT INTO acl_rule (user, item, action, type) VALUES (?, ?, ?, ?)`,
+	_, err = tx.Exec(`INSERT INTO acl_rule (user, item, action, type, seq) VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM acl_rule))`,
 		rule.User, rule.Item, rule.Action, rule.Type)
 	if err != nil {
 		tx.Rollback()
@@ -379,7 +853,8 @@ func (s *SQLiteStorage) GetAclRules() ([]models.AclRule, error) {
 		return nil, ErrNotFound
 	}
 
-	rows, err := s.db.Query(`SELECT user, item, action, type FROM acl_rule`)
+	// Rules are returned in the order they were added, oldest first
+	rows, err := s.db.Query(`SELECT user, item, action, type FROM acl_rule ORDER BY seq`)
 	if err != nil {
 		return nil, err
 	}
@@ -400,6 +875,36 @@ func (s *SQLiteStorage) GetAclRules() ([]models.AclRule, error) {
 	return rules, nil
 }
 
+// GetAclRuleRecords retrieves all ACL rules, oldest first, with the events that created them
+func (s *SQLiteStorage) GetAclRuleRecords() ([]models.AclRuleRecord, error) {
+	if s.db == nil {
+		return nil, ErrNotFound
+	}
+
+	rows, err := s.db.Query(`SELECT user, item, action, type, COALESCE(event_uuid, ''), COALESCE(event_user, ''), COALESCE(event_timestamp, 0)
+		FROM acl_rule ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []models.AclRuleRecord{}
+	for rows.Next() {
+		var r models.AclRuleRecord
+		var timestamp int64
+		if err := rows.Scan(&r.User, &r.Item, &r.Action, &r.Type, &r.EventUuid, &r.Author, &timestamp); err != nil {
+			return nil, err
+		}
+		r.Timestamp = uint64(timestamp)
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
 // Get the DB path from the DB_PATH environment variable, if it exists.
 // Otherwise uses ./data/simple-sync.db
 // Returns an absolute filesystem path or ":memory:". The caller builds a
@@ -3,6 +3,8 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -70,25 +72,125 @@ func NewTestStorage(aclRules []models.AclRule) *TestStorage {
 	for _, rule := range aclRules {
 		ruleJson, _ := json.Marshal(rule)
 
-		storage.events = append(storage.events, *models.NewEvent(
+		storage.appendEvents([]models.Event{*models.NewEvent(
 			".root",
 			".acl",
 			".acl.addRule",
 			string(ruleJson),
-		))
+		)})
 	}
 
 	return storage
 }
 
-// AddEvents appends new events to the storage
+// AddEvents appends new events to the storage, creating users for .user.create events
 func (m *TestStorage) AddEvents(events []models.Event) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	m.events = append(m.events, events...)
+	return m.addEvents(events)
+}
+
+// addEvents appends events and creates their users. Must be called with the
+// mutex held.
+func (m *TestStorage) addEvents(events []models.Event) error {
+	// Check every created user before changing anything, so the batch is atomic
+	newUsers := make(map[string]*models.User)
+	for i := range events {
+		if !events[i].IsUserCreateEvent() {
+			continue
+		}
+		user, err := events[i].ToUser()
+		if err != nil {
+			return err
+		}
+		if _, exists := m.users[user.Id]; exists {
+			return ErrUserExists
+		}
+		if _, exists := newUsers[user.Id]; exists {
+			return ErrUserExists
+		}
+		newUsers[user.Id] = user
+	}
+
+	m.appendEvents(events)
+	for id, user := range newUsers {
+		m.users[id] = user
+	}
+	return nil
+}
+
+// SubmitEvents stores submitted events, skipping events that were already stored
+func (m *TestStorage) SubmitEvents(events []models.Event, atomic bool) ([]models.EventResult, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var pending []models.Event // Stored at the end when atomic
+	var pendingIndexes []int
+	results := make([]models.EventResult, len(events))
+	for i := range events {
+		results[i] = models.EventResult{UUID: events[i].UUID, Status: models.EventStatusAccepted}
+		err := events[i].Validate()
+		if err == nil {
+			existing := findEvent(m.events, events[i].UUID)
+			if existing == nil {
+				existing = findEvent(pending, events[i].UUID)
+			}
+			if existing != nil {
+				if existing.SameContent(&events[i]) {
+					results[i].Status = models.EventStatusDuplicate
+					continue
+				}
+				err = ErrDuplicateKey
+			} else if atomic {
+				pending = append(pending, events[i])
+				pendingIndexes = append(pendingIndexes, i)
+				continue
+			} else {
+				err = m.addEvents(events[i : i+1])
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if atomic {
+			return nil, err
+		}
+		results[i].Status = models.EventStatusRejected
+		results[i].Error = err.Error()
+		results[i].Err = err
+	}
+
+	if err := m.addEvents(pending); err != nil {
+		return nil, err
+	}
+	for j, i := range pendingIndexes {
+		events[i].Seq = pending[j].Seq
+	}
+	return results, nil
+}
+
+// findEvent returns the event with the given UUID, or nil
+func findEvent(events []models.Event, uuid string) *models.Event {
+	for i := range events {
+		if events[i].UUID == uuid {
+			return &events[i]
+		}
+	}
 	return nil
 }
 
+// appendEvents assigns the next sequence numbers to events and appends them.
+// Events are never removed, so an event's sequence number is its position.
+func (m *TestStorage) appendEvents(events []models.Event) {
+	for i := range events {
+		if events[i].TimestampMs == 0 {
+			events[i].TimestampMs = events[i].UuidTimestampMs()
+		}
+		events[i].Seq = uint64(len(m.events) + 1)
+		m.events = append(m.events, events[i])
+	}
+}
+
 // LoadEvents returns all stored events
 func (m *TestStorage) LoadEvents() ([]models.Event, error) {
 	m.mutex.RLock()
@@ -101,6 +203,42 @@ func (m *TestStorage) LoadEvents() ([]models.Event, error) {
 	return allEvents, nil
 }
 
+// QueryEvents returns the events matching the query in sequence order
+func (m *TestStorage) QueryEvents(query models.EventQuery) ([]models.Event, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if query.After != "" {
+		// An unknown UUID cursor is placed after the events with smaller UUIDs
+		if existing := findEvent(m.events, query.After); existing != nil {
+			query.AfterSeq = existing.Seq
+		} else {
+			for _, event := range m.events {
+				if event.UUID < query.After {
+					query.AfterSeq = max(query.AfterSeq, event.Seq)
+				}
+			}
+		}
+	}
+
+	events := make([]models.Event, 0)
+	for _, event := range m.events {
+		if query.Matches(&event) {
+			events = append(events, event)
+		}
+	}
+
+	if query.Limit > 0 && len(events) > query.Limit {
+		events = events[:query.Limit]
+	}
+
+	return events, nil
+}
+
 // GetUserById retrieves a user by id
 func (m *TestStorage) GetUserById(id string) (*models.User, error) {
 	m.mutex.RLock()
@@ -112,6 +250,18 @@ func (m *TestStorage) GetUserById(id string) (*models.User, error) {
 	return user, nil
 }
 
+// GetUsers retrieves all users, ordered by ID
+func (m *TestStorage) GetUsers() ([]models.User, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	users := make([]models.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+	return users, nil
+}
+
 // AddUser stores a new user in test storage
 func (m *TestStorage) AddUser(user *models.User) error {
 	if user == nil {
@@ -151,6 +301,61 @@ func (m *TestStorage) GetApiKeyByHash(hash string) (*models.ApiKey, error) {
 	return nil, ErrApiKeyNotFound
 }
 
+// GetApiKeyByKeyId retrieves an API key by its public key ID
+func (m *TestStorage) GetApiKeyByKeyId(keyId string) (*models.ApiKey, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, apiKey := range m.apiKeys {
+		if keyId != "" && apiKey.KeyId == keyId {
+			return apiKey, nil
+		}
+	}
+	return nil, ErrApiKeyNotFound
+}
+
+// GetApiKeyByUuid retrieves an API key by its UUID
+func (m *TestStorage) GetApiKeyByUuid(uuid string) (*models.ApiKey, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	apiKey, exists := m.apiKeys[uuid]
+	if !exists {
+		return nil, ErrApiKeyNotFound
+	}
+	return apiKey, nil
+}
+
+// GetUserApiKeys retrieves the API keys of a user, oldest first
+func (m *TestStorage) GetUserApiKeys(userID string) ([]*models.ApiKey, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	keys := make([]*models.ApiKey, 0)
+	for _, k := range m.apiKeys {
+		if k.User == userID {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].UUID < keys[j].UUID
+	})
+	return keys, nil
+}
+
+// GetLegacyApiKeys retrieves all API keys without a key ID
+func (m *TestStorage) GetLegacyApiKeys() ([]*models.ApiKey, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	keys := make([]*models.ApiKey, 0)
+	for _, k := range m.apiKeys {
+		if k.KeyId == "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
 // GetAllApiKeys retrieves all API keys
 func (m *TestStorage) GetAllApiKeys() ([]*models.ApiKey, error) {
 	m.mutex.RLock()
@@ -162,10 +367,18 @@ func (m *TestStorage) GetAllApiKeys() ([]*models.ApiKey, error) {
 	return keys, nil
 }
 
-// UpdateApiKey updates an existing API key
+// UpdateApiKey updates an existing API key. Like SQLiteStorage, only the
+// last used time and description of a stored key are changed.
 func (m *TestStorage) UpdateApiKey(apiKey *models.ApiKey) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	if existing, exists := m.apiKeys[apiKey.UUID]; exists {
+		updated := *existing
+		updated.LastUsedAt = apiKey.LastUsedAt
+		updated.Description = apiKey.Description
+		m.apiKeys[apiKey.UUID] = &updated
+		return nil
+	}
 	m.apiKeys[apiKey.UUID] = apiKey
 	return nil
 }
@@ -197,14 +410,53 @@ func (m *TestStorage) UpdateSetupToken(token *models.SetupToken) error {
 	return nil
 }
 
+// RedeemSetupToken records a use of a setup token and stores the events and
+// API key issued for it atomically
+func (m *TestStorage) RedeemSetupToken(token string, events []models.Event, apiKey *models.ApiKey) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	setupToken, exists := m.setupTokens[token]
+	if !exists || setupToken.RemainingUses() == 0 {
+		return ErrSetupTokenNotFound
+	}
+	// Events are the only part that can fail, so they are stored first
+	if err := m.addEvents(events); err != nil {
+		return err
+	}
+	setupToken.MarkUsed()
+	m.apiKeys[apiKey.UUID] = apiKey
+	return nil
+}
+
+// Bootstrap stores the events creating the root user and its first API key
+// or setup token atomically
+func (m *TestStorage) Bootstrap(events []models.Event, apiKey *models.ApiKey, setupToken *models.SetupToken) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if (apiKey == nil) == (setupToken == nil) {
+		return ErrInvalidData
+	}
+	// Events are the only part that can fail, so they are stored first
+	if err := m.addEvents(events); err != nil {
+		return err
+	}
+	if apiKey != nil {
+		m.apiKeys[apiKey.UUID] = apiKey
+	} else {
+		m.setupTokens[setupToken.Token] = setupToken
+	}
+	return nil
+}
+
 // InvalidateUserSetupTokens marks all setup tokens for a user as used
 func (m *TestStorage) InvalidateUserSetupTokens(userID string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	now := time.Now()
 	for _, token := range m.setupTokens {
 		if token.User == userID {
-			token.UsedAt = now
+			token.Invalidate()
 		}
 	}
 	return nil
@@ -222,6 +474,33 @@ func (m *TestStorage) InvalidateUserApiKeys(userID string) error {
 	return nil
 }
 
+// ExpireUserApiKeys sets the expiry of all API keys of a user to expiresAt,
+// unless a key already expires earlier
+func (m *TestStorage) ExpireUserApiKeys(userID string, expiresAt time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for uuid, apiKey := range m.apiKeys {
+		if apiKey.User == userID && (apiKey.ExpiresAt == nil || apiKey.ExpiresAt.After(expiresAt)) {
+			// Replace the key so readers holding the old pointer are not affected
+			updated := *apiKey
+			updated.ExpiresAt = &expiresAt
+			m.apiKeys[uuid] = &updated
+		}
+	}
+	return nil
+}
+
+// DeleteApiKey removes a single API key by UUID
+func (m *TestStorage) DeleteApiKey(uuid string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.apiKeys[uuid]; !exists {
+		return ErrApiKeyNotFound
+	}
+	delete(m.apiKeys, uuid)
+	return nil
+}
+
 // AddAclRule stores a new ACL rule
 func (m *TestStorage) AddAclRule(rule *models.AclRule) error {
 	m.mutex.Lock()
@@ -235,26 +514,50 @@ func (m *TestStorage) AddAclRule(rule *models.AclRule) error {
 		".acl.addRule",
 		string(ruleJson),
 	)
-	m.events = append(m.events, *event)
+	m.appendEvents([]models.Event{*event})
 
 	return nil
 }
 
 // GetAclRules retrieves all ACL rules
 func (m *TestStorage) GetAclRules() ([]models.AclRule, error) {
+	records, err := m.GetAclRuleRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []models.AclRule
+	for _, record := range records {
+		rules = append(rules, record.AclRule)
+	}
+	return rules, nil
+}
+
+// GetAclRuleRecords retrieves all ACL rules with the events that created them
+func (m *TestStorage) GetAclRuleRecords() ([]models.AclRuleRecord, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	var rules []models.AclRule
+	// Replay ACL events in order. Adding an existing rule moves it to the
+	// end, matching SQLiteStorage.
+	var records []models.AclRuleRecord
 	for _, event := range m.events {
 		if event.IsAclEvent() {
 			rule, err := event.ToAclRule()
 			if err != nil {
 				return nil, fmt.Errorf("malformed ACL rule in event: %w", err)
 			}
-			rules = append(rules, *rule)
+			records = slices.DeleteFunc(records, func(r models.AclRuleRecord) bool { return r.AclRule == *rule })
+			if event.Action == ".acl.addRule" {
+				records = append(records, models.AclRuleRecord{
+					AclRule:   *rule,
+					EventUuid: event.UUID,
+					Author:    event.User,
+					Timestamp: event.Timestamp,
+				})
+			}
 		}
 	}
 
-	return rules, nil
+	return records, nil
 }
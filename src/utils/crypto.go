@@ -3,32 +3,107 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	apperrors "simple-sync/src/errors"
 )
 
-// GenerateApiKey generates a cryptographically secure random API key
-func GenerateApiKey() (string, error) {
+// apiKeyIdLength is the number of hex characters in an API key ID
+const apiKeyIdLength = 16
+
+// GenerateApiKey generates a cryptographically secure random API key in the
+// format sk_<id>_<secret>. Returns the public key ID and the full key.
+func GenerateApiKey() (string, string, error) {
+	idBytes := make([]byte, apiKeyIdLength/2)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", err
+	}
 	keyBytes := make([]byte, 32) // 256 bits
 	if _, err := rand.Read(keyBytes); err != nil {
-		return "", err
+		return "", "", err
 	}
-	return "sk_" + base64.StdEncoding.EncodeToString(keyBytes)[:43], nil
+	keyId := hex.EncodeToString(idBytes)
+	return keyId, "sk_" + keyId + "_" + base64.StdEncoding.EncodeToString(keyBytes)[:43], nil
 }
 
+// ParseApiKey validates the format of an API key and returns its public key
+// ID. Legacy keys in the format sk_<secret> have no ID, so an empty ID is
+// returned for them.
+func ParseApiKey(apiKey string) (string, error) {
+	secret, ok := strings.CutPrefix(apiKey, "sk_")
+	if !ok {
+		return "", apperrors.ErrInvalidApiKeyFormat
+	}
+
+	// Base64 secrets never contain underscores, so one marks a key ID
+	keyId, idSecret, hasId := strings.Cut(secret, "_")
+	if hasId {
+		if len(keyId) != apiKeyIdLength {
+			return "", apperrors.ErrInvalidApiKeyFormat
+		}
+		if _, err := hex.DecodeString(keyId); err != nil {
+			return "", apperrors.ErrInvalidApiKeyFormat
+		}
+		secret = idSecret
+	} else {
+		keyId = ""
+	}
+
+	// Check the secret is valid base64 (try with padding since keys are truncated)
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+		if _, err := base64.StdEncoding.DecodeString(secret + "="); err != nil {
+			return "", apperrors.ErrInvalidApiKeyFormat
+		}
+	}
+
+	return keyId, nil
+}
+
+// tokenCharset is the alphabet of setup tokens
+const tokenCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Number of 4-character groups in setup tokens
+const (
+	shortTokenGroups = 2 // XXXX-XXXX, about 41 bits
+	longTokenGroups  = 6 // XXXX-XXXX-XXXX-XXXX-XXXX-XXXX, about 124 bits
+)
+
 // GenerateToken generates a random 8-character token with hyphen
 func GenerateToken() (string, error) {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	tokenBytes := make([]byte, 8)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return "", err
-	}
+	return generateToken(shortTokenGroups)
+}
+
+// GenerateLongToken generates a random 24-character token in groups of 4
+// separated by hyphens, for tokens that must resist guessing for longer
+func GenerateLongToken() (string, error) {
+	return generateToken(longTokenGroups)
+}
 
-	token := make([]byte, 9) // 4 + 1 + 4 = 9
-	for i := range 4 {
-		token[i] = charset[tokenBytes[i]%byte(len(charset))]
+// generateToken generates a token of groups of 4 random characters separated
+// by hyphens. Characters are chosen without modulo bias.
+func generateToken(groups int) (string, error) {
+	chars := make([]byte, 0, groups*4)
+	// Bytes at or above this limit would favour the first characters of the charset
+	limit := byte(256 - 256%len(tokenCharset))
+	buf := make([]byte, groups*4)
+	for len(chars) < groups*4 {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b < limit && len(chars) < groups*4 {
+				chars = append(chars, tokenCharset[int(b)%len(tokenCharset)])
+			}
+		}
 	}
-	token[4] = '-'
-	for i := 4; i < 8; i++ {
-		token[i+1] = charset[tokenBytes[i]%byte(len(charset))]
+
+	token := make([]byte, 0, groups*5-1)
+	for i := range groups {
+		if i > 0 {
+			token = append(token, '-')
+		}
+		token = append(token, chars[i*4:i*4+4]...)
 	}
 
 	return string(token), nil
@@ -0,0 +1,117 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostAclCheck(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	aclRules := []models.AclRule{
+		{
+			User:   storage.TestingUserId,
+			Item:   ".acl",
+			Action: ".acl.checkPermission",
+			Type:   "allow",
+		},
+		{
+			User:   "*",
+			Item:   "item.*",
+			Action: "*",
+			Type:   "allow",
+		},
+		{
+			User:   "user.456",
+			Item:   "item.789",
+			Action: "*",
+			Type:   "deny",
+		},
+	}
+
+	h := handlers.NewTestHandlers(aclRules)
+
+	// Register routes with auth middleware
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/acl/check", h.PostAclCheck)
+
+	check := func(body string) (int, models.AclDecision) {
+		req, _ := http.NewRequest("POST", "/api/v1/acl/check", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", storage.TestingApiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var decision models.AclDecision
+		json.Unmarshal(w.Body.Bytes(), &decision)
+		return w.Code, decision
+	}
+
+	// The more specific deny rule decides, followed by the wildcard allow rule
+	code, decision := check(`{"user": "user.456", "item": "item.789", "action": "write"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, models.AclReasonRule, decision.Reason)
+	assert.Equal(t, []models.AclRuleMatch{
+		{AclRule: aclRules[2], ItemSpecificity: 8, UserSpecificity: 8, ActionSpecificity: 0.5},
+		{AclRule: aclRules[1], ItemSpecificity: 5.5, UserSpecificity: 0.5, ActionSpecificity: 0.5},
+	}, decision.Rules)
+
+	// Other users only match the wildcard rule
+	code, decision = check(`{"user": "user.789", "item": "item.789", "action": "write"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 1, len(decision.Rules))
+
+	// No matching rules denies by default
+	code, decision = check(`{"user": "user.456", "item": "other", "action": "write"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, models.AclReasonDefault, decision.Reason)
+	assert.Empty(t, decision.Rules)
+
+	// The root user bypasses the ACL
+	code, decision = check(`{"user": ".root", "item": "other", "action": "write"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, models.AclReasonRoot, decision.Reason)
+
+	// All fields are required
+	code, _ = check(`{"user": "user.456", "item": "item.789"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestPostAclCheckInsufficientPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	h := handlers.NewTestHandlers(nil)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/acl/check", h.PostAclCheck)
+
+	req, _ := http.NewRequest("POST", "/api/v1/acl/check", bytes.NewBufferString(`{"user": "a", "item": "b", "action": "c"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,118 @@
+package contract
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAcl(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	aclRules := []models.AclRule{
+		{
+			User:   storage.TestingUserId,
+			Item:   ".acl",
+			Action: ".acl.listRules",
+			Type:   "allow",
+		},
+		{
+			User:   "user-456",
+			Item:   "task.1",
+			Action: "read",
+			Type:   "allow",
+		},
+		{
+			User:   "user-456",
+			Item:   "note.1",
+			Action: "write",
+			Type:   "deny",
+		},
+	}
+
+	store := storage.NewTestStorage(aclRules)
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	// Register routes with auth middleware
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/acl", h.GetAcl)
+
+	events, err := store.LoadEvents()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []int // Indexes into aclRules and the events that created them
+	}{
+		{"all rules", "", []int{0, 1, 2}},
+		{"user filter", "?user=user-456", []int{1, 2}},
+		{"item wildcard", "?item=task.*", []int{1}},
+		{"combined filters", "?user=user-*&action=write", []int{2}},
+		{"no matches", "?item=missing", []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/api/v1/acl"+tt.query, nil)
+			req.Header.Set("X-API-Key", storage.TestingApiKey)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response []models.AclRuleRecord
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+			expected := []models.AclRuleRecord{}
+			for _, i := range tt.expected {
+				expected = append(expected, models.AclRuleRecord{
+					AclRule:   aclRules[i],
+					EventUuid: events[i].UUID,
+					Author:    ".root",
+					Timestamp: events[i].Timestamp,
+				})
+			}
+			assert.Equal(t, expected, response)
+		})
+	}
+}
+
+func TestGetAclErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	h := handlers.NewTestHandlers(nil)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/acl", h.GetAcl)
+
+	// Users without the .acl.listRules permission cannot list rules
+	req, _ := http.NewRequest("GET", "/api/v1/acl", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Invalid filter patterns are rejected
+	req, _ = http.NewRequest("GET", "/api/v1/acl?item=a*b", nil)
+	req.Header.Set("X-API-Key", storage.TestingRootApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,110 @@
+package contract
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostAclRemove(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// A mistaken rule allowing everything, plus permission to remove rules
+	aclRules := []models.AclRule{
+		{
+			User:   "*",
+			Item:   "*",
+			Action: "*",
+			Type:   "allow",
+		},
+		{
+			User:   storage.TestingUserId,
+			Item:   ".acl",
+			Action: ".acl.removeRule",
+			Type:   "allow",
+		},
+	}
+
+	store := storage.NewTestStorage(aclRules)
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	// Register routes with auth middleware
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/acl/remove", h.PostAclRemove)
+
+	assert.True(t, h.AclService().CheckPermission("anyone", "anything", "delete"))
+
+	removeJSON := `[{"user": "*", "item": "*", "action": "*", "type": "allow"}]`
+
+	req, _ := http.NewRequest("POST", "/api/v1/acl/remove", bytes.NewBufferString(removeJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message": "ACL rules removed"}`, w.Body.String())
+
+	// The rule no longer applies and the removal was recorded
+	assert.False(t, h.AclService().CheckPermission("anyone", "anything", "delete"))
+	events, err := store.LoadEvents()
+	assert.NoError(t, err)
+	last := events[len(events)-1]
+	assert.Equal(t, storage.TestingUserId, last.User)
+	assert.Equal(t, ".acl", last.Item)
+	assert.Equal(t, ".acl.removeRule", last.Action)
+
+	// Removing it again fails since the rule no longer exists
+	req, _ = http.NewRequest("POST", "/api/v1/acl/remove", bytes.NewBufferString(removeJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPostAclRemoveInsufficientPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Permission to add rules does not grant permission to remove them
+	aclRules := []models.AclRule{
+		{
+			User:   storage.TestingUserId,
+			Item:   ".acl",
+			Action: ".acl.addRule",
+			Type:   "allow",
+		},
+	}
+
+	h := handlers.NewTestHandlers(aclRules)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/acl/remove", h.PostAclRemove)
+
+	removeJSON := `[{"user": "user-123", "item": ".acl", "action": ".acl.addRule", "type": "allow"}]`
+	req, _ := http.NewRequest("POST", "/api/v1/acl/remove", bytes.NewBufferString(removeJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.True(t, h.AclService().CheckPermission(storage.TestingUserId, ".acl", ".acl.addRule"))
+}
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"simple-sync/src/handlers"
 	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/services"
 	"simple-sync/src/storage"
 
 	"github.com/gin-gonic/gin"
@@ -145,3 +148,191 @@ func TestPostSetupExchangeToken(t *testing.T) {
 	assert.NotEmpty(t, response["apiKey"])
 	assert.NotEmpty(t, response["user"])
 }
+
+func TestPostUserResetKeyRotate(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Setup handlers
+	h := handlers.NewTestHandlers(nil)
+
+	// Register routes
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+	auth.POST("/user/resetKey", h.PostUserResetKey)
+
+	request := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Invalid grace periods are rejected, including ones that overflow a Duration
+	for _, gracePeriod := range []string{"-1", "2592001", "9223372037", "18446744074"} {
+		w := request("POST", "/api/v1/user/resetKey", storage.TestingRootApiKey,
+			`{"user": "`+storage.TestingUserId+`", "rotate": true, "gracePeriod": `+gracePeriod+`}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, gracePeriod)
+	}
+
+	w := request("GET", "/api/v1/events", storage.TestingApiKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request("POST", "/api/v1/user/resetKey", storage.TestingRootApiKey,
+		`{"user": "`+storage.TestingUserId+`", "rotate": true, "gracePeriod": 3600, "description": "Rotated"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		KeyUuid         string    `json:"keyUuid"`
+		ApiKey          string    `json:"apiKey"`
+		User            string    `json:"user"`
+		Description     string    `json:"description"`
+		OldKeysExpireAt time.Time `json:"oldKeysExpireAt"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.ApiKey)
+	assert.Equal(t, storage.TestingUserId, response.User)
+	assert.Equal(t, "Rotated", response.Description)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), response.OldKeysExpireAt, time.Minute)
+
+	// Both the old and the new key work during the grace period
+	w = request("GET", "/api/v1/events", storage.TestingApiKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request("GET", "/api/v1/events", response.ApiKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The rotation is recorded in the event payload
+	w = request("GET", "/api/v1/events", storage.TestingRootApiKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var events []models.Event
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	var payload models.ResetKeyPayload
+	for _, event := range events {
+		if event.Action == ".user.resetKey" {
+			assert.NoError(t, json.Unmarshal([]byte(event.Payload), &payload))
+		}
+	}
+	assert.True(t, payload.Rotate)
+	assert.Equal(t, int64(3600), payload.GracePeriod)
+	assert.Equal(t, response.KeyUuid, payload.KeyUuid)
+	if assert.NotNil(t, payload.OldKeysExpireAt) {
+		assert.True(t, response.OldKeysExpireAt.Equal(*payload.OldKeysExpireAt))
+	}
+}
+
+func TestPostSetupExchangeTokenThrottling(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Setup handlers
+	h := handlers.NewTestHandlers(nil)
+
+	// Register routes
+	v1 := router.Group("/api/v1")
+	v1.POST("/user/exchangeToken", h.PostSetupExchangeToken)
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+
+	exchange := func(token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/user/exchangeToken", bytes.NewBufferString(`{"token": "`+token+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Failed attempts are allowed until the client is locked out
+	for range services.DefaultClientThrottleLimits.FreeFailures + 1 {
+		w := exchange("AAAA-AAAA")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	// While locked out, even valid tokens are rejected
+	setupToken, err := h.AuthService().GenerateSetupTokenWithOptions(storage.TestingUserId, models.SetupTokenOptions{Long: true})
+	assert.NoError(t, err)
+	assert.Len(t, setupToken.Token, 29)
+	w := exchange(setupToken.Token)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	time.Sleep(services.DefaultClientThrottleLimits.BaseLockout)
+	w = exchange(setupToken.Token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Failed attempts are logged without the token or the client IP
+	req, _ := http.NewRequest("GET", "/api/v1/events", nil)
+	req.Header.Set("X-API-Key", storage.TestingRootApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.NotContains(t, w.Body.String(), "AAAA-AAAA")
+	assert.NotContains(t, w.Body.String(), "192.0.2.1")
+	var events []models.Event
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	var failures []models.ExchangeTokenFailedPayload
+	for _, event := range events {
+		if event.Action == ".user.exchangeTokenFailed" {
+			var payload models.ExchangeTokenFailedPayload
+			assert.NoError(t, json.Unmarshal([]byte(event.Payload), &payload))
+			failures = append(failures, payload)
+		}
+	}
+	if assert.Len(t, failures, services.DefaultClientThrottleLimits.FreeFailures+1) {
+		last := failures[len(failures)-1]
+		assert.Equal(t, services.DefaultClientThrottleLimits.FreeFailures+1, last.Failures)
+		assert.Equal(t, int64(1), last.Lockout)
+	}
+}
+
+func TestPostUserGenerateTokenMultiUse(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Setup handlers
+	h := handlers.NewTestHandlers(nil)
+
+	// Register routes
+	v1 := router.Group("/api/v1")
+	v1.POST("/user/exchangeToken", h.PostSetupExchangeToken)
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/user/generateToken", h.PostUserGenerateToken)
+
+	request := func(path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", storage.TestingRootApiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The TTL is bounded by the server, including TTLs that overflow a Duration
+	for _, ttl := range []string{"-1", "31536000", "9223372037", "18446744074060"} {
+		w := request("/api/v1/user/generateToken", `{"user": "`+storage.TestingUserId+`", "ttl": `+ttl+`}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "ttl %s", ttl)
+	}
+
+	w := request("/api/v1/user/generateToken", `{"user": "`+storage.TestingUserId+`", "ttl": 3600, "maxUses": 2}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), response.ExpiresAt, time.Minute)
+
+	// The token can be exchanged twice
+	for _, expected := range []int{http.StatusOK, http.StatusOK, http.StatusBadRequest} {
+		w = request("/api/v1/user/exchangeToken", `{"token": "`+response.Token+`"}`)
+		assert.Equal(t, expected, w.Code)
+	}
+}
@@ -0,0 +1,269 @@
+package contract
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// readStreamEvent reads the next event from a Server-Sent Events stream, skipping comments
+func readStreamEvent(t *testing.T, reader *bufio.Reader) (string, models.Event) {
+	var id string
+	var event models.Event
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("failed to parse stream data: %v", err)
+			}
+		case line == "" && id != "":
+			return id, event
+		}
+	}
+}
+
+func TestGetEventsStream(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Setup ACL rules to allow the test user to create items
+	aclRules := []models.AclRule{
+		{
+			User:   storage.TestingUserId,
+			Item:   "item456",
+			Action: "create",
+			Type:   "allow",
+		},
+	}
+
+	store := storage.NewTestStorage(aclRules)
+	seen := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	missed := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	assert.NoError(t, store.AddEvents([]models.Event{*seen, *missed}))
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	// Register routes with auth
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events/stream", h.GetEventsStream)
+	auth.POST("/events", h.PostEvents)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Connect, resuming after the event the client already has
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/v1/events/stream", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	req.Header.Set("Last-Event-ID", seen.UUID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+
+	// The missed event is replayed first, with the sequence number assigned
+	// after the ACL rule event and the seen event
+	missed.Seq = 3
+	id, event := readStreamEvent(t, reader)
+	assert.Equal(t, missed.UUID, id)
+	assert.Equal(t, *missed, event)
+
+	// Newly posted events are pushed in real time
+	posted := models.NewEvent(storage.TestingUserId, "item456", "create", `{"live": true}`)
+	body, _ := json.Marshal([]models.Event{*posted})
+	postReq, _ := http.NewRequest("POST", server.URL+"/api/v1/events", bytes.NewBuffer(body))
+	postReq.Header.Set("Content-Type", "application/json")
+	postReq.Header.Set("X-API-Key", storage.TestingApiKey)
+	postResp, err := http.DefaultClient.Do(postReq)
+	if err != nil {
+		t.Fatalf("failed to post event: %v", err)
+	}
+	postResp.Body.Close()
+	assert.Equal(t, http.StatusOK, postResp.StatusCode)
+
+	posted.Seq = 4
+	id, event = readStreamEvent(t, reader)
+	assert.Equal(t, posted.UUID, id)
+	assert.Equal(t, *posted, event)
+}
+
+// delayedStorage holds up each write after storing its events, the earlier
+// writes the longest, so that writers finish in the opposite order they stored
+type delayedStorage struct {
+	*storage.TestStorage
+	writes atomic.Int32
+}
+
+func (s *delayedStorage) AddEvents(events []models.Event) error {
+	if err := s.TestStorage.AddEvents(events); err != nil {
+		return err
+	}
+	time.Sleep(time.Duration(10-s.writes.Add(1)) * time.Millisecond)
+	return nil
+}
+
+func (s *delayedStorage) SubmitEvents(events []models.Event, atomic bool) ([]models.EventResult, error) {
+	results, err := s.TestStorage.SubmitEvents(events, atomic)
+	time.Sleep(time.Duration(10-s.writes.Add(1)) * time.Millisecond)
+	return results, err
+}
+
+func TestGetEventsStreamOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	aclRules := []models.AclRule{
+		{User: storage.TestingUserId, Item: "item456", Action: "create", Type: "allow"},
+	}
+	store := &delayedStorage{TestStorage: storage.NewTestStorage(aclRules)}
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events/stream", h.GetEventsStream)
+	auth.POST("/events", h.PostEvents)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/v1/events/stream", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Post events concurrently
+	const count = 8
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			event := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+			body, _ := json.Marshal([]models.Event{*event})
+			postReq, _ := http.NewRequest("POST", server.URL+"/api/v1/events", bytes.NewBuffer(body))
+			postReq.Header.Set("Content-Type", "application/json")
+			postReq.Header.Set("X-API-Key", storage.TestingApiKey)
+			postResp, err := http.DefaultClient.Do(postReq)
+			if err != nil {
+				t.Errorf("failed to post event: %v", err)
+				return
+			}
+			postResp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	// Subscribers receive the events in the order they were stored, after
+	// the events of the initial ACL rules
+	stored, err := store.LoadEvents()
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, len(stored), count)
+	reader := bufio.NewReader(resp.Body)
+	for _, event := range stored[len(stored)-count:] {
+		id, _ := readStreamEvent(t, reader)
+		assert.Equal(t, event.UUID, id)
+	}
+}
+
+func TestGetEventsStreamReconnectAfterSeq(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := storage.NewTestStorage(nil)
+	first := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	seen := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	missed := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	assert.NoError(t, store.AddEvents([]models.Event{*first, *seen, *missed}))
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events/stream", h.GetEventsStream)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An EventSource first connected with afterSeq reconnects to the same
+	// URL with the last event it received in Last-Event-ID
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/v1/events/stream?afterSeq=1", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	req.Header.Set("Last-Event-ID", seen.UUID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Replay resumes after the event in the header
+	missed.Seq = 3
+	id, event := readStreamEvent(t, bufio.NewReader(resp.Body))
+	assert.Equal(t, missed.UUID, id)
+	assert.Equal(t, *missed, event)
+}
+
+func TestGetEventsStreamInvalidLastEventId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	h := handlers.NewTestHandlers(nil)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events/stream", h.GetEventsStream)
+
+	req, _ := http.NewRequest("GET", "/api/v1/events/stream", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	req.Header.Set("Last-Event-ID", "not-a-uuid")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,147 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupEventsV2Router registers the v1 and v2 event routes
+func setupEventsV2Router(h *handlers.Handlers) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+	auth.POST("/events", h.PostEvents)
+
+	v2 := router.Group("/api/v2")
+	authV2 := v2.Group("/")
+	authV2.Use(middleware.AuthMiddleware(h.AuthService()), middleware.ApiVersion(2))
+	authV2.GET("/events", h.GetEvents)
+	authV2.POST("/events", h.PostEvents)
+	return router
+}
+
+func TestGetEventsV2(t *testing.T) {
+	store := storage.NewTestStorage(nil)
+	event := models.NewEvent(storage.TestingUserId, "item1", "create", "{}")
+	assert.NoError(t, store.AddEvents([]models.Event{*event}))
+	router := setupEventsV2Router(handlers.NewTestHandlersWithStorage(store))
+
+	// v2 returns millisecond timestamps taken from the UUID
+	req, _ := http.NewRequest("GET", "/api/v2/events", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var eventsV2 []models.EventV2
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &eventsV2))
+	assert.Len(t, eventsV2, 1)
+	assert.Equal(t, event.UuidTimestampMs(), eventsV2[0].Timestamp)
+
+	// v1 still returns seconds
+	req, _ = http.NewRequest("GET", "/api/v1/events", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var events []models.Event
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	assert.NotEmpty(t, events)
+	assert.Equal(t, event.UUID, events[len(events)-1].UUID)
+	assert.Equal(t, event.Timestamp, events[len(events)-1].Timestamp)
+}
+
+func TestGetEventsV2TimeRange(t *testing.T) {
+	store := storage.NewTestStorage(nil)
+	event := models.NewEvent(storage.TestingUserId, "item1", "create", "{}")
+	assert.NoError(t, store.AddEvents([]models.Event{*event}))
+	router := setupEventsV2Router(handlers.NewTestHandlersWithStorage(store))
+	ms := event.UuidTimestampMs()
+
+	tests := []struct {
+		query string
+		count int
+	}{
+		{fmt.Sprintf("from=%d&to=%d", ms, ms), 1},
+		{fmt.Sprintf("from=%d", ms+1), 0},
+		{fmt.Sprintf("to=%d", ms-1), 0},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/api/v2/events?"+tt.query, nil)
+		req.Header.Set("X-API-Key", storage.TestingApiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, tt.query)
+
+		var page models.EventPageV2
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Len(t, page.Events, tt.count, tt.query)
+	}
+}
+
+func TestPostEventsV2(t *testing.T) {
+	aclRules := []models.AclRule{
+		{User: storage.TestingUserId, Item: "item1", Action: "create", Type: "allow"},
+	}
+	router := setupEventsV2Router(handlers.NewTestHandlers(aclRules))
+
+	event := models.NewEvent(storage.TestingUserId, "item1", "create", "{}")
+	eventV2 := event.V2()
+
+	// A timestamp that doesn't match the UUID's milliseconds is rejected
+	mismatched := eventV2
+	mismatched.Timestamp++
+	body, _ := json.Marshal([]models.EventV2{mismatched})
+	req, _ := http.NewRequest("POST", "/api/v2/events", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A matching timestamp is accepted and returned in milliseconds
+	body, _ = json.Marshal([]models.EventV2{eventV2})
+	req, _ = http.NewRequest("POST", "/api/v2/events", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response []models.EventV2
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response)
+	last := response[len(response)-1]
+	assert.Equal(t, event.UUID, last.UUID)
+	assert.Equal(t, eventV2.Timestamp, last.Timestamp)
+
+	// The same event reads back in seconds from v1
+	req, _ = http.NewRequest("GET", "/api/v1/events", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var events []models.Event
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	assert.NotEmpty(t, events)
+	assert.Equal(t, event.UUID, events[len(events)-1].UUID)
+	assert.Equal(t, event.Timestamp, events[len(events)-1].Timestamp)
+}
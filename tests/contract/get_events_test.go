@@ -1,12 +1,15 @@
 package contract
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"simple-sync/src/handlers"
 	"simple-sync/src/middleware"
+	"simple-sync/src/models"
 	"simple-sync/src/storage"
 
 	"github.com/gin-gonic/gin"
@@ -50,3 +53,157 @@ func TestGetEvents(t *testing.T) {
 	expected := "[]"
 	assert.JSONEq(t, expected, w.Body.String())
 }
+
+func TestGetEventsWithCursor(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Setup handlers with three events already stored
+	store := storage.NewTestStorage(nil)
+	e1 := models.NewEvent(storage.TestingUserId, "item1", "create", "{}")
+	e2 := models.NewEvent(storage.TestingUserId, "item1", "update", "{}")
+	e3 := models.NewEvent(storage.TestingUserId, "item1", "delete", "{}")
+	assert.NoError(t, store.AddEvents([]models.Event{*e1, *e2, *e3}))
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	// Register routes with auth
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+
+	// First page
+	req, _ := http.NewRequest("GET", "/api/v1/events?limit=2", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page models.EventPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 2, len(page.Events))
+	assert.Equal(t, e1.UUID, page.Events[0].UUID)
+	assert.Equal(t, e2.UUID, page.Next)
+	assert.True(t, page.HasMore)
+
+	// Second page continues from the cursor
+	req, _ = http.NewRequest("GET", "/api/v1/events?limit=2&after="+page.Next, nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	page = models.EventPage{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 1, len(page.Events))
+	assert.Equal(t, e3.UUID, page.Events[0].UUID)
+	assert.Equal(t, e3.UUID, page.Next)
+	assert.False(t, page.HasMore)
+
+	// Nothing new after the last cursor
+	req, _ = http.NewRequest("GET", "/api/v1/events?after="+page.Next, nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"events": [], "next": "`+e3.UUID+`", "hasMore": false}`, w.Body.String())
+
+	// The sequence number of an event works as a cursor too
+	req, _ = http.NewRequest("GET", "/api/v1/events?afterSeq=1", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	page = models.EventPage{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 2, len(page.Events))
+	assert.Equal(t, e2.UUID, page.Events[0].UUID)
+	assert.Equal(t, uint64(2), page.Events[0].Seq)
+	assert.Equal(t, uint64(3), page.NextSeq)
+}
+
+func TestGetEventsWithInvalidCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	h := handlers.NewTestHandlers(nil)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+
+	for _, query := range []string{"after=not-a-uuid", "limit=0", "limit=abc", "afterSeq=-1", "afterSeq=1&after=" + models.NewEvent("u", "i", "a", "").UUID} {
+		req, _ := http.NewRequest("GET", "/api/v1/events?"+query, nil)
+		req.Header.Set("X-API-Key", storage.TestingApiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestGetEventsWithFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := storage.NewTestStorage(nil)
+	taskEvent := models.NewEvent("user.42", "task.1", "create", "{}")
+	noteEvent := models.NewEvent("user.42", "note.1", "create", "{}")
+	otherUserEvent := models.NewEvent("user.7", "task.2", "create", "{}")
+	assert.NoError(t, store.AddEvents([]models.Event{*taskEvent, *noteEvent, *otherUserEvent}))
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+
+	url := fmt.Sprintf("/api/v1/events?item=task.*&user=user.42&from=%d&to=%d", taskEvent.Timestamp, taskEvent.Timestamp+60)
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page models.EventPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 1, len(page.Events))
+	assert.Equal(t, taskEvent.UUID, page.Events[0].UUID)
+	assert.False(t, page.HasMore)
+
+	// Invalid filters are rejected
+	for _, query := range []string{"item=task.*.x", "from=yesterday", "from=200&to=100"} {
+		req, _ := http.NewRequest("GET", "/api/v1/events?"+query, nil)
+		req.Header.Set("X-API-Key", storage.TestingApiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestGetEventsUnknownParameter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	h := handlers.NewTestHandlers(nil)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+
+	// Parameters other than the paging and filter parameters, such as cache
+	// busters, keep the full history array
+	req, _ := http.NewRequest("GET", "/api/v1/events?_=123", nil)
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 
@@ -149,3 +150,260 @@ func TestConcurrentPostEvents(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(events))
 }
+
+func TestPostEventsRetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	h := handlers.NewTestHandlers([]models.AclRule{
+		{User: storage.TestingUserId, Item: "item456", Action: "create", Type: "allow"},
+	})
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/events", h.PostEvents)
+
+	post := func(body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", "/api/v1/events", bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", storage.TestingApiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	event := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	assert.Equal(t, http.StatusOK, post([]models.Event{*event}).Code)
+
+	// Resubmitting an identical event, e.g. after a timeout, succeeds without storing it again
+	w := post([]models.Event{*event})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var events []models.Event
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	count := 0
+	for _, e := range events {
+		if e.UUID == event.UUID {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+
+	// A different event reusing the UUID is a conflict
+	conflicting := *event
+	conflicting.Payload = `{"changed":true}`
+	w = post([]models.Event{conflicting})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "Event UUID already exists with different content")
+}
+
+func TestPostEventsResults(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := storage.NewTestStorage([]models.AclRule{
+		{User: storage.TestingUserId, Item: "item456", Action: "create", Type: "allow"},
+	})
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/events", h.PostEvents)
+
+	stored := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	if err := store.AddEvents([]models.Event{*stored}); err != nil {
+		t.Fatalf("AddEvents failed: %v", err)
+	}
+	conflicting := *models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	conflicting.UUID = stored.UUID
+	conflicting.Payload = "changed"
+	fresh := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	denied := models.NewEvent(storage.TestingUserId, "other", "create", "{}")
+
+	body, _ := json.Marshal(map[string]any{"events": []models.Event{*stored, conflicting, *fresh, *denied}})
+	req, _ := http.NewRequest("POST", "/api/v1/events", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", storage.TestingApiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Each event gets its own result instead of failing the batch
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Results []models.EventResult `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []models.EventResult{
+		{UUID: stored.UUID, Status: models.EventStatusDuplicate},
+		{UUID: stored.UUID, Status: models.EventStatusRejected, Error: "Event UUID already exists with different content"},
+		{UUID: fresh.UUID, Status: models.EventStatusAccepted},
+		{UUID: denied.UUID, Status: models.EventStatusRejected, Error: "Insufficient permissions"},
+	}, response.Results)
+
+	events, _ := store.LoadEvents()
+	uuids := map[string]int{}
+	for _, e := range events {
+		uuids[e.UUID]++
+	}
+	assert.Equal(t, 1, uuids[stored.UUID])
+	assert.Equal(t, 1, uuids[fresh.UUID])
+	assert.Equal(t, 0, uuids[denied.UUID])
+}
+
+func TestPostEventsDelta(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := storage.NewTestStorage([]models.AclRule{
+		{User: storage.TestingUserId, Item: "item456", Action: "create", Type: "allow"},
+	})
+	seen := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	missed := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	if err := store.AddEvents([]models.Event{*seen, *missed}); err != nil {
+		t.Fatalf("AddEvents failed: %v", err)
+	}
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/events", h.PostEvents)
+
+	post := func(body any, since string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", "/api/v1/events", bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", storage.TestingApiKey)
+		if since != "" {
+			req.Header.Set("X-Events-Since", since)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// An array with a cursor header gets back the events after the cursor
+	first := models.NewEvent(storage.TestingUserId, "item456", "create", `{"n": 1}`)
+	w := post([]models.Event{*first}, seen.UUID)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page models.EventPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	missed.Seq, first.Seq = 3, 4 // After the ACL rule event and the seen event
+	assert.Equal(t, []models.Event{*missed, *first}, page.Events)
+	assert.Equal(t, first.UUID, page.Next)
+	assert.Equal(t, uint64(4), page.NextSeq)
+	assert.False(t, page.HasMore)
+
+	// A wrapper object gives the cursor in the body, next to the results
+	second := models.NewEvent(storage.TestingUserId, "item456", "create", `{"n": 2}`)
+	w = post(map[string]any{"events": []models.Event{*second}, "since": page.Next}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Results []models.EventResult `json:"results"`
+		models.EventPage
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []models.EventResult{{UUID: second.UUID, Status: models.EventStatusAccepted}}, response.Results)
+	second.Seq = 5
+	assert.Equal(t, []models.Event{*second}, response.Events)
+	assert.Equal(t, second.UUID, response.Next)
+
+	// Without a cursor, the wrapper response only has the results
+	third := models.NewEvent(storage.TestingUserId, "item456", "create", `{"n": 3}`)
+	w = post(map[string]any{"events": []models.Event{*third}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"next"`)
+
+	// Invalid cursors are rejected before storing anything
+	rejected := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	assert.Equal(t, http.StatusBadRequest, post([]models.Event{*rejected}, "not-a-uuid").Code)
+	assert.Equal(t, http.StatusBadRequest, post(map[string]any{"events": []models.Event{*rejected}, "since": "not-a-uuid"}, "").Code)
+	events, _ := store.LoadEvents()
+	for _, e := range events {
+		assert.NotEqual(t, rejected.UUID, e.UUID)
+	}
+}
+
+func TestPostEventsServerAssignedIds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := storage.NewTestStorage([]models.AclRule{
+		{User: storage.TestingUserId, Item: "item456", Action: "create", Type: "allow"},
+	})
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/events", h.PostEvents)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/events", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", storage.TestingApiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	stored := func(uuid string) *models.Event {
+		events, _ := store.LoadEvents()
+		for _, e := range events {
+			if e.UUID == uuid {
+				return &e
+			}
+		}
+		return nil
+	}
+
+	// Events without a UUID and timestamp are assigned them by the server,
+	// alongside events with client IDs
+	client := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	clientJSON, _ := json.Marshal(client)
+	// alongside events with client IDs. The response gives the results of
+	// the events in request order, like for a wrapped batch.
+	w := post(`[{"user":"user-123","item":"item456","action":"create","payload":"{}"},` + string(clientJSON) + `]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Results []models.EventResult `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.Len(t, response.Results, 2) {
+		assert.Equal(t, models.EventStatusAccepted, response.Results[0].Status)
+		assert.Equal(t, client.UUID, response.Results[1].UUID)
+		assigned := stored(response.Results[0].UUID)
+		if assert.NotNil(t, assigned) {
+			assert.NoError(t, assigned.Validate())
+			assert.Equal(t, "item456", assigned.Item)
+		}
+		uuids := strings.Split(w.Header().Get("X-Event-Uuids"), ",")
+		assert.Equal(t, []string{response.Results[0].UUID, client.UUID}, uuids)
+	}
+
+	// Events with client IDs keep the array response without the header
+	w = post(`[` + string(clientJSON) + `]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Event-Uuids"))
+	var events []models.Event
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+
+	// Rejected requests store nothing and don't get the header
+	w = post(`[{"user":"user-123","item":"item456","action":"create","payload":"{}"},{"user":"user-123","item":"other","action":"create","payload":"{}"}]`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("X-Event-Uuids"))
+
+	// The results of a wrapped batch give the assigned UUIDs
+	w = post(`{"events":[{"user":"user-123","item":"item456","action":"create","payload":"{}"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.Len(t, response.Results, 1) {
+		assert.Equal(t, models.EventStatusAccepted, response.Results[0].Status)
+		assert.NotNil(t, stored(response.Results[0].UUID))
+	}
+
+	// A timestamp without a UUID is still invalid
+	w = post(`[{"timestamp":1700000000,"user":"user-123","item":"item456","action":"create","payload":"{}"}]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
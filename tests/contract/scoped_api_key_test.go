@@ -0,0 +1,97 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopedApiKeys(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	aclRules := []models.AclRule{
+		{
+			User:   storage.TestingUserId,
+			Item:   "*",
+			Action: "*",
+			Type:   "allow",
+		},
+	}
+
+	h := handlers.NewTestHandlers(aclRules)
+
+	// Register routes
+	v1 := router.Group("/api/v1")
+	v1.POST("/user/exchangeToken", h.PostSetupExchangeToken)
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+	auth.POST("/events", h.PostEvents)
+	auth.POST("/user/generateToken", h.PostUserGenerateToken)
+
+	request := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Unknown scopes are rejected
+	w := request("POST", "/api/v1/user/generateToken", storage.TestingRootApiKey,
+		`{"user": "`+storage.TestingUserId+`", "scopes": ["events:delete"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Generate a read-only setup token and exchange it for a key
+	w = request("POST", "/api/v1/user/generateToken", storage.TestingRootApiKey,
+		`{"user": "`+storage.TestingUserId+`", "scopes": ["events:read"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokenResponse struct {
+		Token  string   `json:"token"`
+		Scopes []string `json:"scopes"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokenResponse))
+	assert.Equal(t, []string{models.ScopeEventsRead}, tokenResponse.Scopes)
+
+	w = request("POST", "/api/v1/user/exchangeToken", "", `{"token": "`+tokenResponse.Token+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var keyResponse struct {
+		ApiKey string   `json:"apiKey"`
+		Scopes []string `json:"scopes"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &keyResponse))
+	assert.Equal(t, []string{models.ScopeEventsRead}, keyResponse.Scopes)
+
+	// The key can read events but not write them, even though the ACL allows it
+	w = request("GET", "/api/v1/events", keyResponse.ApiKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	eventJSON, _ := json.Marshal([]models.Event{*models.NewEvent(storage.TestingUserId, "item456", "create", "{}")})
+	w = request("POST", "/api/v1/events", keyResponse.ApiKey, string(eventJSON))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "events:write")
+
+	// Nor can it hand out tokens
+	w = request("POST", "/api/v1/user/generateToken", keyResponse.ApiKey,
+		`{"user": "`+storage.TestingUserId+`"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// An unrestricted key can still write
+	w = request("POST", "/api/v1/events", storage.TestingApiKey, string(eventJSON))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,174 @@
+package contract
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupSyncServer starts a test server exposing the WebSocket sync endpoint
+func setupSyncServer(t *testing.T, store storage.Storage) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/sync", h.GetSync)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dialSync opens a sync connection and completes the handshake
+func dialSync(t *testing.T, server *httptest.Server, apiKey, lastEventId string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/sync"
+	header := http.Header{}
+	header.Set("X-API-Key", apiKey)
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("failed to dial sync endpoint: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	hello := models.NewSyncFrame(models.SyncFrameHello)
+	hello.LastEventId = lastEventId
+	assert.NoError(t, conn.WriteJSON(hello))
+
+	welcome := readSyncFrame(t, conn)
+	assert.Equal(t, models.SyncFrameWelcome, welcome.Type)
+	assert.Equal(t, models.SyncProtocolVersion, welcome.Version)
+	return conn
+}
+
+// readSyncFrame reads the next frame with a timeout
+func readSyncFrame(t *testing.T, conn *websocket.Conn) models.SyncFrame {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame models.SyncFrame
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("failed to read sync frame: %v", err)
+	}
+	return frame
+}
+
+func TestSyncReplayAndPush(t *testing.T) {
+	aclRules := []models.AclRule{
+		{
+			User:   storage.TestingUserId,
+			Item:   "item456",
+			Action: "create",
+			Type:   "allow",
+		},
+	}
+	store := storage.NewTestStorage(aclRules)
+	seen := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	missed := models.NewEvent(storage.TestingUserId, "item456", "create", "{}")
+	assert.NoError(t, store.AddEvents([]models.Event{*seen, *missed}))
+
+	server := setupSyncServer(t, store)
+
+	// Device A resumes after the event it has already seen
+	deviceA := dialSync(t, server, storage.TestingApiKey, seen.UUID)
+	replay := readSyncFrame(t, deviceA)
+	assert.Equal(t, models.SyncFrameEvents, replay.Type)
+	missed.Seq = 3 // After the ACL rule event and the seen event
+	assert.Equal(t, []models.Event{*missed}, replay.Events)
+
+	// Device B starts from scratch and receives the full history
+	deviceB := dialSync(t, server, storage.TestingApiKey, "")
+	replay = readSyncFrame(t, deviceB)
+	assert.Equal(t, models.SyncFrameEvents, replay.Type)
+	assert.Equal(t, 3, len(replay.Events)) // ACL rule event plus the two stored events
+
+	// Device A pushes one valid and one forbidden event
+	allowed := models.NewEvent(storage.TestingUserId, "item456", "create", `{"from": "A"}`)
+	forbidden := models.NewEvent(storage.TestingUserId, "other-item", "create", "{}")
+	push := models.NewSyncFrame(models.SyncFramePush)
+	push.Id = "batch-1"
+	push.Events = []models.Event{*allowed, *forbidden}
+	assert.NoError(t, deviceA.WriteJSON(push))
+
+	results := map[string]models.SyncFrame{}
+	for i := 0; i < 2; i++ {
+		frame := readSyncFrame(t, deviceA)
+		assert.Equal(t, "batch-1", frame.Id)
+		results[frame.EventUuid] = frame
+	}
+	assert.Equal(t, models.SyncFrameAck, results[allowed.UUID].Type)
+	assert.Equal(t, models.SyncFrameReject, results[forbidden.UUID].Type)
+	assert.Equal(t, "Insufficient permissions", results[forbidden.UUID].Error)
+
+	// Device B receives the accepted event in real time
+	live := readSyncFrame(t, deviceB)
+	assert.Equal(t, models.SyncFrameEvents, live.Type)
+	allowed.Seq = 4
+	assert.Equal(t, []models.Event{*allowed}, live.Events)
+
+	// Re-pushing a stored event is acknowledged without publishing it again
+	push = models.NewSyncFrame(models.SyncFramePush)
+	push.Id = "batch-2"
+	push.Events = []models.Event{*missed}
+	assert.NoError(t, deviceA.WriteJSON(push))
+	ack := readSyncFrame(t, deviceA)
+	assert.Equal(t, models.SyncFrameAck, ack.Type)
+	assert.Equal(t, missed.UUID, ack.EventUuid)
+
+	// Device A is not sent its own event back
+	deviceA.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var echo models.SyncFrame
+	assert.Error(t, deviceA.ReadJSON(&echo))
+	deviceB.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	assert.Error(t, deviceB.ReadJSON(&echo))
+}
+
+func TestSyncHandshakeErrors(t *testing.T) {
+	server := setupSyncServer(t, storage.NewTestStorage(nil))
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/sync"
+
+	// Missing API key is rejected before the upgrade
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	header := http.Header{}
+	header.Set("X-API-Key", storage.TestingApiKey)
+
+	tests := []struct {
+		name  string
+		hello models.SyncFrame
+		error string
+	}{
+		{"wrong version", models.SyncFrame{Version: 99, Type: models.SyncFrameHello}, "unsupported protocol version"},
+		{"wrong frame type", models.NewSyncFrame(models.SyncFramePush), "expected hello frame"},
+		{"invalid cursor", models.SyncFrame{Version: models.SyncProtocolVersion, Type: models.SyncFrameHello, LastEventId: "bad"}, "cursor must be a valid event UUID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _, err := websocket.DefaultDialer.Dial(url, header)
+			if err != nil {
+				t.Fatalf("failed to dial sync endpoint: %v", err)
+			}
+			defer conn.Close()
+
+			assert.NoError(t, conn.WriteJSON(tt.hello))
+			frame := readSyncFrame(t, conn)
+			assert.Equal(t, models.SyncFrameError, frame.Type)
+			assert.Equal(t, tt.error, frame.Error)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostEventsUserCreate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	store := storage.NewTestStorage(nil)
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/events", h.PostEvents)
+
+	post := func(apiKey string, event *models.Event) *httptest.ResponseRecorder {
+		body, _ := json.Marshal([]models.Event{*event})
+		req, _ := http.NewRequest("POST", "/api/v1/events", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Root creates a new user
+	w := post(storage.TestingRootApiKey, models.NewEvent(".root", ".user.alice", ".user.create", "{}"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	user, err := store.GetUserById("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Id)
+
+	// Creating the same user again conflicts
+	w = post(storage.TestingRootApiKey, models.NewEvent(".root", ".user.alice", ".user.create", "{}"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Malformed user items are rejected
+	w = post(storage.TestingRootApiKey, models.NewEvent(".root", ".user.", ".user.create", "{}"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Users without the .user.create permission cannot create users
+	w = post(storage.TestingApiKey, models.NewEvent(storage.TestingUserId, ".user.bob", ".user.create", "{}"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	_, err = store.GetUserById("bob")
+	assert.Equal(t, storage.ErrNotFound, err)
+}
@@ -0,0 +1,105 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostUserInvite(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Setup handlers
+	h := handlers.NewTestHandlers(nil)
+
+	// Register routes
+	v1 := router.Group("/api/v1")
+	v1.POST("/user/exchangeToken", h.PostSetupExchangeToken)
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+	auth.POST("/user/invite", h.PostUserInvite)
+
+	request := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	invite := `{"user": "invitee", "aclRules": [{"user": "invitee", "item": "project.*", "action": "*", "type": "allow"}]}`
+
+	// Inviting requires permission to create the user
+	w := request("POST", "/api/v1/user/invite", storage.TestingApiKey, invite)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Existing users cannot be invited
+	w = request("POST", "/api/v1/user/invite", storage.TestingRootApiKey, `{"user": "`+storage.TestingUserId+`"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Invalid rules are rejected
+	w = request("POST", "/api/v1/user/invite", storage.TestingRootApiKey, `{"user": "invitee", "aclRules": [{"user": "invitee", "item": "project.*", "action": "*", "type": "maybe"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Out of range TTLs are rejected, including TTLs that overflow a Duration
+	for _, ttl := range []string{"-1", "31536000", "18446744074060"} {
+		w = request("POST", "/api/v1/user/invite", storage.TestingRootApiKey, `{"user": "invitee", "ttl": `+ttl+`}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "ttl %s", ttl)
+	}
+
+	w = request("POST", "/api/v1/user/invite", storage.TestingRootApiKey, invite)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var inviteResponse map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inviteResponse))
+	assert.Equal(t, "invitee", inviteResponse["user"])
+	token, _ := inviteResponse["token"].(string)
+
+	// The rules only apply once the invitation is exchanged
+	assert.False(t, h.AclService().CheckPermission("invitee", "project.alpha", "edit"))
+
+	w = request("POST", "/api/v1/user/exchangeToken", "", `{"token": "`+token+`", "description": "Laptop"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var exchangeResponse map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &exchangeResponse))
+	assert.Equal(t, "invitee", exchangeResponse["user"])
+
+	assert.True(t, h.AclService().CheckPermission("invitee", "project.alpha", "edit"))
+
+	// The user now exists
+	w = request("POST", "/api/v1/user/invite", storage.TestingRootApiKey, invite)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The creation of the user and its rules is recorded as internal events
+	w = request("GET", "/api/v1/events", storage.TestingRootApiKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var events []models.Event
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	actions := make(map[string]bool)
+	for _, event := range events {
+		if event.Item == ".user.invitee" || (event.Item == ".acl" && event.User == ".root") {
+			actions[event.Action] = true
+		}
+	}
+	assert.True(t, actions[".user.invite"])
+	assert.True(t, actions[".user.create"])
+	assert.True(t, actions[".acl.addRule"])
+	assert.True(t, actions[".user.exchangeToken"])
+
+	// The invitation cannot be used again
+	w = request("POST", "/api/v1/user/exchangeToken", "", `{"token": "`+token+`"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
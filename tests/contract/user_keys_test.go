@@ -0,0 +1,113 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserKeys(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// The test user can list but not revoke its own keys
+	aclRules := []models.AclRule{
+		{
+			User:   storage.TestingUserId,
+			Item:   ".user." + storage.TestingUserId,
+			Action: ".user.listKeys",
+			Type:   "allow",
+		},
+	}
+
+	h := handlers.NewTestHandlers(aclRules)
+
+	// Register routes
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+	auth.GET("/user/keys", h.GetUserKeys)
+	auth.GET("/user/keys/:uuid", h.GetUserKey)
+	auth.DELETE("/user/keys/:uuid", h.DeleteUserKey)
+
+	request := func(method, path, apiKey string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(nil))
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Give the test user a second key
+	laptopKey, laptopPlainKey, err := h.AuthService().GenerateApiKey(storage.TestingUserId, "Laptop")
+	assert.NoError(t, err)
+
+	w := request("GET", "/api/v1/user/keys", storage.TestingApiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "hash")
+	var keys []models.ApiKeyInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	assert.Len(t, keys, 2)
+	for _, key := range keys {
+		assert.Equal(t, storage.TestingUserId, key.User)
+		if key.UUID == laptopKey.UUID {
+			assert.Equal(t, laptopKey.KeyId, key.KeyId)
+			assert.Equal(t, "Laptop", key.Description)
+		}
+	}
+
+	w = request("GET", "/api/v1/user/keys/"+laptopKey.UUID, storage.TestingApiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Other users' keys need permission
+	w = request("GET", "/api/v1/user/keys?user=.root", storage.TestingApiKey)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = request("GET", "/api/v1/user/keys/test-root-api-key-uuid", storage.TestingApiKey)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Revoking needs its own permission
+	w = request("DELETE", "/api/v1/user/keys/"+laptopKey.UUID, storage.TestingApiKey)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = request("DELETE", "/api/v1/user/keys/"+laptopKey.UUID, storage.TestingRootApiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Only the revoked key stops working
+	w = request("GET", "/api/v1/user/keys", laptopPlainKey)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = request("GET", "/api/v1/user/keys", storage.TestingApiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	assert.Len(t, keys, 1)
+
+	w = request("DELETE", "/api/v1/user/keys/"+laptopKey.UUID, storage.TestingRootApiKey)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The revocation is logged
+	w = request("GET", "/api/v1/events", storage.TestingRootApiKey)
+	var events []models.Event
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	var revocations []models.Event
+	for _, event := range events {
+		if event.Action == ".user.revokeKey" {
+			revocations = append(revocations, event)
+		}
+	}
+	if assert.Len(t, revocations, 1) {
+		assert.Equal(t, ".root", revocations[0].User)
+		assert.Equal(t, ".user."+storage.TestingUserId, revocations[0].Item)
+		assert.JSONEq(t, `{"keyUuid": "`+laptopKey.UUID+`"}`, revocations[0].Payload)
+	}
+}
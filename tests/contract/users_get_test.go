@@ -0,0 +1,63 @@
+package contract
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUsers(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Setup handlers
+	h := handlers.NewTestHandlers(nil)
+
+	// Register routes
+	v1 := router.Group("/api/v1")
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/users", h.GetUsers)
+	auth.GET("/user/me", h.GetUserMe)
+
+	request := func(path, apiKey string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Listing users requires the .user.list permission
+	w := request("/api/v1/users", storage.TestingApiKey)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = request("/api/v1/users", storage.TestingRootApiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var users []models.User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	ids := []string{}
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	assert.Equal(t, []string{".root", storage.TestingUserId}, ids)
+
+	// Any key can identify itself
+	w = request("/api/v1/user/me", storage.TestingApiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var me struct {
+		User string `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &me))
+	assert.Equal(t, storage.TestingUserId, me.User)
+}
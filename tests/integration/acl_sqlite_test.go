@@ -0,0 +1,131 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupSQLiteRouter creates a router backed by the SQLite database at path
+func setupSQLiteRouter(t *testing.T, path string) (*gin.Engine, *handlers.Handlers, *storage.SQLiteStorage) {
+	store := storage.NewSQLiteStorage()
+	if err := store.Initialize(path); err != nil {
+		t.Fatalf("failed to initialize sqlite storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	auth := router.Group("/api/v1")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.POST("/events", h.PostEvents)
+	auth.GET("/acl", h.GetAcl)
+	auth.POST("/acl", h.PostAcl)
+	auth.POST("/acl/remove", h.PostAclRemove)
+	return router, h, store
+}
+
+// postJSON sends an authenticated JSON POST request
+func postJSON(router *gin.Engine, path, apiKey string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", apiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAclRulesTakeEffectInSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simple-sync.db")
+	router, h, store := setupSQLiteRouter(t, path)
+
+	// Create the root user and a regular user with API keys
+	for _, id := range []string{".root", "alice"} {
+		user, err := models.NewUser(id)
+		assert.NoError(t, err)
+		assert.NoError(t, store.AddUser(user))
+	}
+	_, rootKey, err := h.AuthService().GenerateApiKey(".root", "root")
+	assert.NoError(t, err)
+	_, aliceKey, err := h.AuthService().GenerateApiKey("alice", "alice")
+	assert.NoError(t, err)
+
+	// Alice cannot write before a rule grants access
+	w := postJSON(router, "/api/v1/events", aliceKey, []models.Event{*models.NewEvent("alice", "doc", "write", "{}")})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Root grants access
+	rules := []models.AclRule{{User: "alice", Item: "doc", Action: "write", Type: "allow"}}
+	w = postJSON(router, "/api/v1/acl", rootKey, rules)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The rule and its event are both stored
+	stored, err := store.GetAclRules()
+	assert.NoError(t, err)
+	assert.Equal(t, rules, stored)
+	events, err := store.LoadEvents()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, ".acl.addRule", events[0].Action)
+
+	// The rule applies immediately
+	w = postJSON(router, "/api/v1/events", aliceKey, []models.Event{*models.NewEvent("alice", "doc", "write", "{}")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// A later deny rule overrides the earlier allow rule
+	w = postJSON(router, "/api/v1/acl", rootKey, []models.AclRule{{User: "alice", Item: "doc", Action: "write", Type: "deny"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(router, "/api/v1/events", aliceKey, []models.Event{*models.NewEvent("alice", "doc", "write", "{}")})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Re-adding the allow rule makes it the most recent again
+	w = postJSON(router, "/api/v1/acl", rootKey, rules)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(router, "/api/v1/events", aliceKey, []models.Event{*models.NewEvent("alice", "doc", "write", "{}")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Removing the deny rule leaves the allow rule in effect
+	w = postJSON(router, "/api/v1/acl/remove", rootKey, []models.AclRule{{User: "alice", Item: "doc", Action: "write", Type: "deny"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	stored, err = store.GetAclRules()
+	assert.NoError(t, err)
+	assert.Equal(t, rules, stored)
+
+	// The listed rule records the event that created it
+	req, _ := http.NewRequest("GET", "/api/v1/acl?user=alice", nil)
+	req.Header.Set("X-API-Key", rootKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var records []models.AclRuleRecord
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &records))
+	events, err = store.LoadEvents()
+	assert.NoError(t, err)
+	var lastAdd models.Event
+	for _, event := range events {
+		if event.Action == ".acl.addRule" {
+			lastAdd = event
+		}
+	}
+	assert.Equal(t, []models.AclRuleRecord{{AclRule: rules[0], EventUuid: lastAdd.UUID, Author: ".root", Timestamp: lastAdd.Timestamp}}, records)
+
+	// Rules survive a restart
+	assert.NoError(t, store.Close())
+	router, _, _ = setupSQLiteRouter(t, path)
+	w = postJSON(router, "/api/v1/events", aliceKey, []models.Event{*models.NewEvent("alice", "doc", "write", "{}")})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
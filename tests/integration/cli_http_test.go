@@ -0,0 +1,94 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-sync/src/cli"
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCliOverHttp(t *testing.T) {
+	// Setup Gin router in test mode
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	store := storage.NewTestStorage(nil)
+	h := handlers.NewTestHandlersWithStorage(store)
+
+	// Register routes
+	v1 := router.Group("/api/v1")
+	v1.POST("/user/exchangeToken", h.PostSetupExchangeToken)
+	auth := v1.Group("/")
+	auth.Use(middleware.AuthMiddleware(h.AuthService()))
+	auth.GET("/events", h.GetEvents)
+	auth.POST("/events", h.PostEvents)
+	auth.GET("/acl", h.GetAcl)
+	auth.POST("/acl", h.PostAcl)
+	auth.POST("/acl/check", h.PostAclCheck)
+	auth.GET("/users", h.GetUsers)
+	auth.GET("/user/me", h.GetUserMe)
+	auth.POST("/user/generateToken", h.PostUserGenerateToken)
+	auth.DELETE("/user/keys/:uuid", h.DeleteUserKey)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	app := &cli.App{
+		Stdout: stdout,
+		Stderr: stderr,
+		OpenStorage: func() storage.Storage {
+			t.Fatal("commands with -url must not open the database")
+			return nil
+		},
+		PollInterval: 10 * time.Millisecond,
+	}
+	run := func(apiKey string, args ...string) int {
+		stdout.Reset()
+		stderr.Reset()
+		args = append(args[:2:2], append([]string{"-url", server.URL, "-key", apiKey}, args[2:]...)...)
+		return app.Run(context.Background(), args)
+	}
+
+	assert.Equal(t, 0, run(storage.TestingRootApiKey, "user", "add", "alice"))
+	assert.Equal(t, 0, run(storage.TestingRootApiKey, "user", "list"))
+	assert.Contains(t, stdout.String(), "alice")
+
+	assert.Equal(t, 0, run(storage.TestingRootApiKey, "key", "issue", "-description", "Laptop", "alice"))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	aliceKey := lines[len(lines)-1]
+	userID, err := h.AuthService().ValidateApiKey(aliceKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+
+	assert.Equal(t, 0, run(storage.TestingRootApiKey, "acl", "add", "allow", "alice", "project.*", "*"))
+	assert.Equal(t, 0, run(storage.TestingRootApiKey, "acl", "list", "-user", "alice"))
+	assert.Contains(t, stdout.String(), "project.*")
+	assert.Equal(t, 0, run(storage.TestingRootApiKey, "acl", "check", "alice", "project.alpha", "edit"))
+	assert.True(t, strings.HasPrefix(stdout.String(), "allowed"))
+
+	assert.Equal(t, 0, run(storage.TestingRootApiKey, "events", "export", "-item", ".user.alice"))
+	assert.Contains(t, stdout.String(), `"action":".user.create"`)
+
+	// Commands are subject to the permissions of the API key
+	assert.Equal(t, 1, run(aliceKey, "user", "add", "bob"))
+	assert.Contains(t, stderr.String(), "HTTP 403")
+
+	keys, err := store.GetUserApiKeys("alice")
+	assert.NoError(t, err)
+	if assert.Len(t, keys, 1) {
+		assert.Equal(t, 0, run(storage.TestingRootApiKey, "key", "revoke", keys[0].UUID))
+	}
+	_, err = h.AuthService().ValidateApiKey(aliceKey)
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package performance
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"simple-sync/src/handlers"
+	"simple-sync/src/middleware"
+	"simple-sync/src/models"
+	"simple-sync/src/services"
+	"simple-sync/src/storage"
+	"simple-sync/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupAuthBenchmark creates a SQLite store holding keyCount API keys and
+// returns a router authenticating with cache, plus a valid key
+func setupAuthBenchmark(b *testing.B, keyCount int, cache *services.AuthCache) (*gin.Engine, string) {
+	store := storage.NewSQLiteStorage()
+	if err := store.Initialize(filepath.Join(b.TempDir(), "bench.db")); err != nil {
+		b.Fatalf("failed to initialize sqlite storage: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+
+	user, _ := models.NewUser("bench-user")
+	if err := store.AddUser(user); err != nil {
+		b.Fatalf("failed to add user: %v", err)
+	}
+
+	// Only the presented key needs a real hash; lookups are by key ID
+	for i := 0; i < keyCount-1; i++ {
+		key := models.NewApiKey(user.Id, fmt.Sprintf("unused-hash-%d", i), "filler")
+		key.KeyId = fmt.Sprintf("%016x", i)
+		if err := store.AddApiKey(key); err != nil {
+			b.Fatalf("failed to add key: %v", err)
+		}
+	}
+	keyId, plainKey, err := utils.GenerateApiKey()
+	if err != nil {
+		b.Fatalf("failed to generate key: %v", err)
+	}
+	keyHash, _ := bcrypt.GenerateFromPassword([]byte(plainKey), bcrypt.DefaultCost)
+	key := models.NewApiKey(user.Id, string(keyHash), "bench")
+	key.KeyId = keyId
+	if err := store.AddApiKey(key); err != nil {
+		b.Fatalf("failed to add key: %v", err)
+	}
+
+	h := handlers.NewTestHandlersWithStorage(store)
+	authService := services.NewAuthServiceWithCache(store, cache)
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	auth := router.Group("/api/v1")
+	auth.Use(middleware.AuthMiddleware(authService))
+	auth.GET("/health", h.GetHealth)
+	return router, plainKey
+}
+
+// BenchmarkAuthenticatedRequests10kKeys reports authenticated requests per
+// second with 10,000 stored keys, with and without the validation cache
+func BenchmarkAuthenticatedRequests10kKeys(b *testing.B) {
+	caches := []struct {
+		name  string
+		cache func() *services.AuthCache
+	}{
+		{"uncached", func() *services.AuthCache { return nil }},
+		{"cached", func() *services.AuthCache {
+			return services.NewAuthCache(services.DefaultAuthCacheTTL, services.DefaultAuthCacheMaxEntries)
+		}},
+	}
+
+	for _, tt := range caches {
+		b.Run(tt.name, func(b *testing.B) {
+			router, apiKey := setupAuthBenchmark(b, 10000, tt.cache())
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					req, _ := http.NewRequest("GET", "/api/v1/health", nil)
+					req.Header.Set("X-API-Key", apiKey)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					if w.Code != http.StatusOK {
+						b.Fatalf("expected 200, got %d", w.Code)
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+		})
+	}
+}
@@ -75,3 +75,48 @@ func TestSQLiteStorageConcurrent(t *testing.T) {
 	expected := writers * eventsPerWriter
 	assert.Equal(t, expected, len(events), "expected total events to equal writers*eventsPerWriter")
 }
+
+// TestSQLiteStorageConcurrentSubmit submits events from concurrent writers to SQLiteStorage
+func TestSQLiteStorageConcurrentSubmit(t *testing.T) {
+	s := storage.NewSQLiteStorage()
+	tmp := t.TempDir()
+	dbPath := tmp + "/perf_test.db"
+	if err := s.Initialize(dbPath); err != nil {
+		t.Fatalf("failed to init sqlite: %v", err)
+	}
+	defer s.Close()
+
+	writers := 10
+	eventsPerWriter := 100
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, writers)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < eventsPerWriter; i++ {
+				e := models.NewEvent("concurrent-user", "item", "action", "{}")
+				if _, err := s.SubmitEvents([]models.Event{*e}, true); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		assert.NoError(t, err)
+	}
+
+	events, err := s.LoadEvents()
+	if err != nil {
+		t.Fatalf("failed to load events: %v", err)
+	}
+	expected := writers * eventsPerWriter
+	assert.Equal(t, expected, len(events), "expected total events to equal writers*eventsPerWriter")
+}
@@ -117,3 +117,30 @@ func TestAclRuleValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestAclRuleQuery(t *testing.T) {
+	rule := &models.AclRule{User: "user-456", Item: "task.*", Action: "read", Type: "allow"}
+
+	tests := []struct {
+		name    string
+		query   models.AclRuleQuery
+		matches bool
+	}{
+		{"empty query", models.AclRuleQuery{}, true},
+		{"exact user", models.AclRuleQuery{User: "user-456"}, true},
+		{"other user", models.AclRuleQuery{User: "user-789"}, false},
+		{"item prefix", models.AclRuleQuery{Item: "task*"}, true},
+		{"wildcard rule item is literal", models.AclRuleQuery{Item: "task.1"}, false},
+		{"all fields", models.AclRuleQuery{User: "user-*", Item: "*", Action: "read"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.query.Validate())
+			assert.Equal(t, tt.matches, tt.query.Matches(rule))
+		})
+	}
+
+	invalid := models.AclRuleQuery{Action: "re*ad"}
+	assert.Error(t, invalid.Validate())
+}
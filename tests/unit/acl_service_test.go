@@ -1,8 +1,10 @@
 package unit
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"simple-sync/src/models"
 	"simple-sync/src/services"
@@ -149,6 +151,60 @@ func TestAclService_OrderResolution(t *testing.T) {
 	assert.True(t, aclService.CheckPermission("user1", "item1", "action1"))
 }
 
+func TestAclService_RecencyTieBreak(t *testing.T) {
+	sqliteStorage := storage.NewSQLiteStorage()
+	if err := sqliteStorage.Initialize(":memory:"); err != nil {
+		t.Fatalf("failed to initialize sqlite storage: %v", err)
+	}
+	defer sqliteStorage.Close()
+
+	backends := map[string]storage.Storage{
+		"sqlite": sqliteStorage,
+		"test":   storage.NewTestStorage(nil),
+	}
+
+	addRules := func(t *testing.T, store storage.Storage, rules ...models.AclRule) {
+		var events []models.Event
+		for _, rule := range rules {
+			payload, _ := json.Marshal(rule)
+			events = append(events, *models.NewEvent(".root", ".acl", ".acl.addRule", string(payload)))
+		}
+		assert.NoError(t, store.AddEvents(events))
+	}
+
+	allow := models.AclRule{User: "user1", Item: "item1", Action: "action1", Type: "allow"}
+	deny := models.AclRule{User: "user1", Item: "item1", Action: "action1", Type: "deny"}
+
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) {
+			// Less specific rules that also match, enough to exercise the sort
+			var others []models.AclRule
+			for _, user := range []string{"*", "u*", "us*", "use*"} {
+				for _, item := range []string{"*", "i*", "it*", "ite*"} {
+					others = append(others, models.AclRule{User: user, Item: item, Action: "*", Type: "deny"})
+				}
+			}
+			addRules(t, store, others...)
+
+			// Rules added in the same batch share a timestamp; the later one wins
+			addRules(t, store, deny, allow)
+			aclService, err := services.NewAclService(store)
+			assert.NoError(t, err)
+			assert.True(t, aclService.CheckPermission("user1", "item1", "action1"))
+
+			// Re-adding a rule makes it the most recent
+			addRules(t, store, deny)
+			aclService, err = services.NewAclService(store)
+			assert.NoError(t, err)
+			assert.False(t, aclService.CheckPermission("user1", "item1", "action1"))
+
+			decision := aclService.Explain("user1", "item1", "action1")
+			assert.Equal(t, deny, decision.Rules[0].AclRule)
+			assert.Equal(t, allow, decision.Rules[1].AclRule)
+		})
+	}
+}
+
 func TestAclService_NewAclService_ErrorHandling(t *testing.T) {
 	// Create a mock storage that fails on GetAclRules
 	store := &failingStorage{}
@@ -184,10 +240,18 @@ func (f *failingStorage) AddEvents(events []models.Event) error {
 	return fmt.Errorf("storage error")
 }
 
+func (f *failingStorage) SubmitEvents(events []models.Event, atomic bool) ([]models.EventResult, error) {
+	return nil, fmt.Errorf("storage error")
+}
+
 func (f *failingStorage) LoadEvents() ([]models.Event, error) {
 	return nil, fmt.Errorf("storage error")
 }
 
+func (f *failingStorage) QueryEvents(query models.EventQuery) ([]models.Event, error) {
+	return nil, fmt.Errorf("storage error")
+}
+
 func (f *failingStorage) AddUser(user *models.User) error {
 	return fmt.Errorf("storage error")
 }
@@ -204,6 +268,22 @@ func (f *failingStorage) GetApiKeyByHash(hash string) (*models.ApiKey, error) {
 	return nil, fmt.Errorf("storage error")
 }
 
+func (f *failingStorage) GetApiKeyByKeyId(keyId string) (*models.ApiKey, error) {
+	return nil, fmt.Errorf("storage error")
+}
+
+func (f *failingStorage) GetApiKeyByUuid(uuid string) (*models.ApiKey, error) {
+	return nil, fmt.Errorf("storage error")
+}
+
+func (f *failingStorage) GetUserApiKeys(userID string) ([]*models.ApiKey, error) {
+	return nil, fmt.Errorf("storage error")
+}
+
+func (f *failingStorage) GetLegacyApiKeys() ([]*models.ApiKey, error) {
+	return nil, fmt.Errorf("storage error")
+}
+
 func (f *failingStorage) GetAllApiKeys() ([]*models.ApiKey, error) {
 	return nil, fmt.Errorf("storage error")
 }
@@ -216,6 +296,14 @@ func (f *failingStorage) InvalidateUserApiKeys(userID string) error {
 	return fmt.Errorf("storage error")
 }
 
+func (f *failingStorage) ExpireUserApiKeys(userID string, expiresAt time.Time) error {
+	return fmt.Errorf("storage error")
+}
+
+func (f *failingStorage) DeleteApiKey(uuid string) error {
+	return fmt.Errorf("storage error")
+}
+
 func (f *failingStorage) AddSetupToken(token *models.SetupToken) error {
 	return fmt.Errorf("storage error")
 }
@@ -228,6 +316,18 @@ func (f *failingStorage) UpdateSetupToken(token *models.SetupToken) error {
 	return fmt.Errorf("storage error")
 }
 
+func (f *failingStorage) GetUsers() ([]models.User, error) {
+	return nil, fmt.Errorf("storage error")
+}
+
+func (f *failingStorage) RedeemSetupToken(token string, events []models.Event, apiKey *models.ApiKey) error {
+	return fmt.Errorf("storage error")
+}
+
+func (f *failingStorage) Bootstrap(events []models.Event, apiKey *models.ApiKey, setupToken *models.SetupToken) error {
+	return fmt.Errorf("storage error")
+}
+
 func (f *failingStorage) InvalidateUserSetupTokens(userID string) error {
 	return fmt.Errorf("storage error")
 }
@@ -239,3 +339,7 @@ func (f *failingStorage) AddAclRule(rule *models.AclRule) error {
 func (f *failingStorage) GetAclRules() ([]models.AclRule, error) {
 	return nil, fmt.Errorf("storage error")
 }
+
+func (f *failingStorage) GetAclRuleRecords() ([]models.AclRuleRecord, error) {
+	return nil, fmt.Errorf("storage error")
+}
@@ -1,6 +1,7 @@
 package unit
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -132,3 +133,58 @@ func TestSQLiteAclRulesPreserveInsertionOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestAddEventsRemoveAclRule(t *testing.T) {
+	sqliteStorage := storage.NewSQLiteStorage()
+	if err := sqliteStorage.Initialize(":memory:"); err != nil {
+		t.Fatalf("failed to initialize sqlite storage: %v", err)
+	}
+	defer sqliteStorage.Close()
+
+	backends := map[string]storage.Storage{
+		"sqlite": sqliteStorage,
+		"test":   storage.NewTestStorage(nil),
+	}
+
+	allow := models.AclRule{User: "*", Item: "*", Action: "*", Type: "allow"}
+	read := models.AclRule{User: "alice", Item: "doc", Action: "read", Type: "allow"}
+	aclEvent := func(action string, rule models.AclRule) models.Event {
+		payload, _ := json.Marshal(rule)
+		return *models.NewEvent(".root", ".acl", action, string(payload))
+	}
+
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) {
+			err := store.AddEvents([]models.Event{
+				aclEvent(".acl.addRule", allow),
+				aclEvent(".acl.addRule", read),
+			})
+			if err != nil {
+				t.Fatalf("failed to add rules: %v", err)
+			}
+
+			if err := store.AddEvents([]models.Event{aclEvent(".acl.removeRule", allow)}); err != nil {
+				t.Fatalf("failed to remove rule: %v", err)
+			}
+			rules, err := store.GetAclRules()
+			if err != nil {
+				t.Fatalf("failed to get rules: %v", err)
+			}
+			if len(rules) != 1 || rules[0] != read {
+				t.Fatalf("expected only %v to remain, got %v", read, rules)
+			}
+
+			// Re-adding a removed rule makes it the most recent
+			if err := store.AddEvents([]models.Event{aclEvent(".acl.addRule", allow)}); err != nil {
+				t.Fatalf("failed to add rule: %v", err)
+			}
+			rules, err = store.GetAclRules()
+			if err != nil {
+				t.Fatalf("failed to get rules: %v", err)
+			}
+			if len(rules) != 2 || rules[1] != allow {
+				t.Fatalf("expected %v to be the most recent rule, got %v", allow, rules)
+			}
+		})
+	}
+}
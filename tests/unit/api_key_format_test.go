@@ -0,0 +1,48 @@
+package unit
+
+import (
+	"testing"
+
+	"simple-sync/src/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateApiKeyFormat(t *testing.T) {
+	keyId, key, err := utils.GenerateApiKey()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{16}$`, keyId)
+	assert.Regexp(t, `^sk_[0-9a-f]{16}_[A-Za-z0-9+/]{43}$`, key)
+
+	parsedId, err := utils.ParseApiKey(key)
+	assert.NoError(t, err)
+	assert.Equal(t, keyId, parsedId)
+}
+
+func TestParseApiKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		keyId   string
+		wantErr bool
+	}{
+		{"key with ID", "sk_0123456789abcdef_fSiYfCABeWUsDjgU3ExViC7/UCkccpxyllbCNJsMGYk", "0123456789abcdef", false},
+		{"legacy key", "sk_fSiYfCABeWUsDjgU3ExViC7/UCkccpxyllbCNJsMGYk", "", false},
+		{"missing prefix", "fSiYfCABeWUsDjgU3ExViC7/UCkccpxyllbCNJsMGYk", "", true},
+		{"short key ID", "sk_0123_fSiYfCABeWUsDjgU3ExViC7/UCkccpxyllbCNJsMGYk", "", true},
+		{"non-hex key ID", "sk_0123456789abcdeg_fSiYfCABeWUsDjgU3ExViC7/UCkccpxyllbCNJsMGYk", "", true},
+		{"invalid secret", "sk_0123456789abcdef_not base64!", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyId, err := utils.ParseApiKey(tt.key)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.keyId, keyId)
+		})
+	}
+}
@@ -106,3 +106,16 @@ func TestApiKeyUpdateLastUsed(t *testing.T) {
 	assert.NotNil(t, key.LastUsedAt)
 	assert.WithinDuration(t, time.Now(), *key.LastUsedAt, time.Second)
 }
+
+func TestApiKeyIsExpired(t *testing.T) {
+	apiKey := models.NewApiKey("user123", "hash", "test")
+	assert.False(t, apiKey.IsExpired())
+
+	future := time.Now().Add(time.Hour)
+	apiKey.ExpiresAt = &future
+	assert.False(t, apiKey.IsExpired())
+
+	past := time.Now().Add(-time.Second)
+	apiKey.ExpiresAt = &past
+	assert.True(t, apiKey.IsExpired())
+}
@@ -0,0 +1,109 @@
+package unit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"simple-sync/src/models"
+	"simple-sync/src/services"
+	"simple-sync/src/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthCacheGetSet(t *testing.T) {
+	cache := services.NewAuthCache(time.Minute, 10)
+
+	_, ok := cache.Get("sk_key")
+	assert.False(t, ok)
+
+	cache.Set("sk_key", &models.ApiKey{User: "user-1", UUID: "key-uuid-1"}, cache.Generation())
+	apiKey, ok := cache.Get("sk_key")
+	assert.True(t, ok)
+	assert.Equal(t, "user-1", apiKey.User)
+	assert.Equal(t, "key-uuid-1", apiKey.UUID)
+
+	// Other keys are not affected
+	_, ok = cache.Get("sk_other")
+	assert.False(t, ok)
+}
+
+func TestAuthCacheExpiry(t *testing.T) {
+	cache := services.NewAuthCache(10*time.Millisecond, 10)
+
+	cache.Set("sk_key", &models.ApiKey{User: "user-1", UUID: "key-uuid-1"}, cache.Generation())
+	time.Sleep(20 * time.Millisecond)
+
+	_, ok := cache.Get("sk_key")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestAuthCacheBounded(t *testing.T) {
+	cache := services.NewAuthCache(time.Minute, 5)
+
+	for i := 0; i < 20; i++ {
+		cache.Set(fmt.Sprintf("sk_key%d", i), &models.ApiKey{User: "user-1", UUID: fmt.Sprintf("key-uuid-%d", i)}, cache.Generation())
+	}
+	assert.Equal(t, 5, cache.Len())
+
+	// The most recent entry is kept
+	_, ok := cache.Get("sk_key19")
+	assert.True(t, ok)
+}
+
+func TestAuthCacheInvalidation(t *testing.T) {
+	cache := services.NewAuthCache(time.Minute, 10)
+
+	cache.Set("sk_a1", &models.ApiKey{User: "user-a", UUID: "key-a1"}, cache.Generation())
+	cache.Set("sk_a2", &models.ApiKey{User: "user-a", UUID: "key-a2"}, cache.Generation())
+	cache.Set("sk_b1", &models.ApiKey{User: "user-b", UUID: "key-b1"}, cache.Generation())
+
+	cache.InvalidateKey("key-a1")
+	_, ok := cache.Get("sk_a1")
+	assert.False(t, ok)
+	_, ok = cache.Get("sk_a2")
+	assert.True(t, ok)
+
+	cache.InvalidateUser("user-a")
+	_, ok = cache.Get("sk_a2")
+	assert.False(t, ok)
+	_, ok = cache.Get("sk_b1")
+	assert.True(t, ok)
+
+	// A validation that started before an invalidation is not cached
+	generation := cache.Generation()
+	cache.InvalidateUser("user-b")
+	cache.Set("sk_b1", &models.ApiKey{User: "user-b", UUID: "key-b1"}, generation)
+	_, ok = cache.Get("sk_b1")
+	assert.False(t, ok)
+}
+
+func TestAuthServiceCacheRevocation(t *testing.T) {
+	store := storage.NewTestStorage(nil)
+	authService := services.NewAuthService(store)
+
+	apiKey, plainKey, err := authService.GenerateApiKey(storage.TestingUserId, "one")
+	assert.NoError(t, err)
+	_, otherKey, err := authService.GenerateApiKey(storage.TestingUserId, "two")
+	assert.NoError(t, err)
+
+	for _, key := range []string{plainKey, otherKey} {
+		userID, err := authService.ValidateApiKey(key)
+		assert.NoError(t, err)
+		assert.Equal(t, storage.TestingUserId, userID)
+	}
+
+	// Revoking a single key takes effect immediately despite the cache
+	assert.NoError(t, authService.RevokeApiKey(apiKey.UUID))
+	_, err = authService.ValidateApiKey(plainKey)
+	assert.Error(t, err)
+	_, err = authService.ValidateApiKey(otherKey)
+	assert.NoError(t, err)
+
+	// So does invalidating all keys of the user
+	assert.NoError(t, authService.InvalidateUserApiKeys(storage.TestingUserId))
+	_, err = authService.ValidateApiKey(otherKey)
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"simple-sync/src/models"
 	"simple-sync/src/services"
 	"simple-sync/src/storage"
 
@@ -58,3 +59,23 @@ func TestSetupTokenValidation(t *testing.T) {
 	token.MarkUsed()
 	assert.False(t, token.IsValid())
 }
+
+func TestSetupTokenRemainingUses(t *testing.T) {
+	token := models.NewSetupToken("ABCD-1234", storage.TestingUserId, time.Now().Add(time.Hour))
+	token.MaxUses = 2
+	assert.Equal(t, 2, token.RemainingUses())
+
+	token.MarkUsed()
+	assert.Equal(t, 1, token.RemainingUses())
+	assert.True(t, token.IsValid())
+
+	token.MarkUsed()
+	assert.Equal(t, 0, token.RemainingUses())
+	assert.False(t, token.IsValid())
+
+	// Invalidating uses up the token
+	token = models.NewSetupToken("ABCD-1234", storage.TestingUserId, time.Now().Add(time.Hour))
+	token.MaxUses = 5
+	token.Invalidate()
+	assert.False(t, token.IsValid())
+}
@@ -2,7 +2,10 @@ package unit
 
 import (
 	"testing"
+	"time"
 
+	apperrors "simple-sync/src/errors"
+	"simple-sync/src/models"
 	"simple-sync/src/services"
 	"simple-sync/src/storage"
 
@@ -69,3 +72,171 @@ func TestValidateApiKey(t *testing.T) {
 	_, err = authService.ValidateApiKey("invalid-key")
 	assert.Error(t, err)
 }
+
+func TestValidateApiKeyById(t *testing.T) {
+	store := storage.NewTestStorage(nil)
+	authService := services.NewAuthService(store)
+
+	apiKey, plainKey, err := authService.GenerateApiKey(storage.TestingUserId, "Test")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, apiKey.KeyId)
+
+	// The key is found through its ID
+	stored, err := store.GetApiKeyByKeyId(apiKey.KeyId)
+	assert.NoError(t, err)
+	assert.Equal(t, apiKey.UUID, stored.UUID)
+
+	userID, err := authService.ValidateApiKey(plainKey)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.TestingUserId, userID)
+
+	// A known ID with the wrong secret is rejected
+	_, err = authService.ValidateApiKey("sk_" + apiKey.KeyId + "_fSiYfCABeWUsDjgU3ExViC7/UCkccpxyllbCNJsMGYk")
+	assert.Equal(t, apperrors.ErrInvalidApiKey, err)
+
+	// An unknown ID is rejected
+	_, err = authService.ValidateApiKey("sk_0123456789abcdef" + plainKey[len("sk_0123456789abcdef"):])
+	assert.Equal(t, apperrors.ErrInvalidApiKey, err)
+
+	// Legacy keys without an ID are still accepted
+	userID, err = authService.ValidateApiKey(storage.TestingApiKey)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.TestingUserId, userID)
+}
+
+func TestRotateUserApiKeys(t *testing.T) {
+	sqliteStore := newTestSQLiteStorage(t)
+	defer sqliteStore.Close()
+	if err := sqliteStore.AddUser(&models.User{Id: storage.TestingUserId, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+
+	for name, store := range map[string]storage.Storage{
+		"memory": storage.NewTestStorage(nil),
+		"sqlite": sqliteStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			authService := services.NewAuthService(store)
+
+			_, oldKey, err := authService.GenerateApiKey(storage.TestingUserId, "old")
+			assert.NoError(t, err)
+			_, err = authService.ValidateApiKey(oldKey)
+			assert.NoError(t, err)
+
+			// During the grace period both keys work
+			newApiKey, newKey, err := authService.RotateUserApiKeys(storage.TestingUserId, time.Now().Add(time.Hour), "new", []string{models.ScopeEventsRead})
+			assert.NoError(t, err)
+			assert.Nil(t, newApiKey.ExpiresAt)
+			assert.Equal(t, []string{models.ScopeEventsRead}, newApiKey.Scopes)
+			_, err = authService.ValidateApiKey(oldKey)
+			assert.NoError(t, err)
+			_, err = authService.ValidateApiKey(newKey)
+			assert.NoError(t, err)
+
+			// Rotating again without a grace period expires both, despite the cache
+			_, newestKey, err := authService.RotateUserApiKeys(storage.TestingUserId, time.Now(), "newest", nil)
+			assert.NoError(t, err)
+			_, err = authService.ValidateApiKey(oldKey)
+			assert.ErrorIs(t, err, apperrors.ErrApiKeyExpired)
+			_, err = authService.ValidateApiKey(newKey)
+			assert.ErrorIs(t, err, apperrors.ErrApiKeyExpired)
+			_, err = authService.ValidateApiKey(newestKey)
+			assert.NoError(t, err)
+
+			// A later expiry does not extend keys that already expired
+			assert.NoError(t, store.ExpireUserApiKeys(storage.TestingUserId, time.Now().Add(time.Hour)))
+			authService = services.NewAuthService(store)
+			_, err = authService.ValidateApiKey(oldKey)
+			assert.ErrorIs(t, err, apperrors.ErrApiKeyExpired)
+			_, err = authService.ValidateApiKey(newestKey)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSetupTokenLifetimeAndUses(t *testing.T) {
+	store := storage.NewTestStorage(nil)
+	authService := services.NewAuthService(store)
+
+	// Out of bounds options are rejected
+	_, err := authService.GenerateSetupTokenWithOptions(storage.TestingUserId, models.SetupTokenOptions{TTL: services.MaxSetupTokenTTL + time.Second})
+	assert.ErrorIs(t, err, apperrors.ErrInvalidTokenTTL)
+	_, err = authService.GenerateSetupTokenWithOptions(storage.TestingUserId, models.SetupTokenOptions{TTL: time.Second})
+	assert.ErrorIs(t, err, apperrors.ErrInvalidTokenTTL)
+	_, err = authService.GenerateSetupTokenWithOptions(storage.TestingUserId, models.SetupTokenOptions{MaxUses: services.MaxSetupTokenUses + 1})
+	assert.ErrorIs(t, err, apperrors.ErrInvalidMaxUses)
+
+	setupToken, err := authService.GenerateSetupTokenWithOptions(storage.TestingUserId, models.SetupTokenOptions{
+		TTL:     time.Hour,
+		MaxUses: 3,
+	})
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), setupToken.ExpiresAt, time.Minute)
+
+	// One invitation onboards three devices, each with its own key
+	keys := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		apiKey, _, err := authService.ExchangeSetupToken(setupToken.Token, "Device")
+		assert.NoError(t, err)
+		keys[apiKey.UUID] = true
+	}
+	assert.Len(t, keys, 3)
+
+	_, _, err = authService.ExchangeSetupToken(setupToken.Token, "Device")
+	assert.ErrorIs(t, err, apperrors.ErrSetupTokenExpired)
+}
+
+func TestGenerateInvitation(t *testing.T) {
+	sqliteStore := newTestSQLiteStorage(t)
+	defer sqliteStore.Close()
+	if err := sqliteStore.AddUser(&models.User{Id: storage.TestingUserId, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+
+	for name, store := range map[string]storage.Storage{
+		"memory": storage.NewTestStorage(nil),
+		"sqlite": sqliteStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			authService := services.NewAuthService(store)
+			rule := models.AclRule{User: "invitee", Item: "project.*", Action: "*", Type: "allow"}
+
+			// Only users that do not exist yet can be invited
+			_, err := authService.GenerateInvitation(".root", storage.TestingUserId, nil, models.SetupTokenOptions{})
+			assert.ErrorIs(t, err, storage.ErrUserExists)
+
+			invitation, err := authService.GenerateInvitation(".root", "invitee", []models.AclRule{rule}, models.SetupTokenOptions{MaxUses: 2})
+			assert.NoError(t, err)
+			_, err = store.GetUserById("invitee")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			// The first exchange creates the user and installs the rules
+			apiKey, _, events, err := authService.RedeemSetupToken(invitation.Token, "Laptop")
+			assert.NoError(t, err)
+			assert.Equal(t, "invitee", apiKey.User)
+			if assert.Len(t, events, 2) {
+				assert.Equal(t, ".user.create", events[0].Action)
+				assert.Equal(t, ".user.invitee", events[0].Item)
+				assert.Equal(t, ".acl.addRule", events[1].Action)
+				assert.Equal(t, ".root", events[1].User)
+			}
+			_, err = store.GetUserById("invitee")
+			assert.NoError(t, err)
+			rules, err := store.GetAclRules()
+			assert.NoError(t, err)
+			assert.Contains(t, rules, rule)
+
+			// Later exchanges only issue keys
+			_, plainKey, events, err := authService.RedeemSetupToken(invitation.Token, "Phone")
+			assert.NoError(t, err)
+			assert.Empty(t, events)
+			userID, err := authService.ValidateApiKey(plainKey)
+			assert.NoError(t, err)
+			assert.Equal(t, "invitee", userID)
+
+			// The invitation is used up
+			_, _, _, err = authService.RedeemSetupToken(invitation.Token, "Tablet")
+			assert.ErrorIs(t, err, apperrors.ErrSetupTokenExpired)
+		})
+	}
+}
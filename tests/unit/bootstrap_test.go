@@ -0,0 +1,120 @@
+package unit
+
+import (
+	"database/sql"
+	"testing"
+
+	apperrors "simple-sync/src/errors"
+	"simple-sync/src/models"
+	"simple-sync/src/services"
+	"simple-sync/src/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootstrapRootApiKey(t *testing.T) {
+	store := newTestSQLiteStorage(t)
+	defer store.Close()
+	authService := services.NewAuthService(store)
+
+	apiKey, plainKey, err := authService.BootstrapRootApiKey("Bootstrap")
+	assert.NoError(t, err)
+	assert.Equal(t, services.RootUserId, apiKey.User)
+
+	userID, err := authService.ValidateApiKey(plainKey)
+	assert.NoError(t, err)
+	assert.Equal(t, services.RootUserId, userID)
+
+	// The creation is recorded as an internal event
+	events, err := store.LoadEvents()
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, ".user.create", events[0].Action)
+		assert.Equal(t, ".user."+services.RootUserId, events[0].Item)
+	}
+
+	// Bootstrapping again is refused without issuing credentials
+	_, _, err = authService.BootstrapRootApiKey("Bootstrap")
+	assert.ErrorIs(t, err, apperrors.ErrAlreadyBootstrapped)
+	_, err = authService.BootstrapRootSetupToken(models.SetupTokenOptions{})
+	assert.ErrorIs(t, err, apperrors.ErrAlreadyBootstrapped)
+	apiKeys, err := store.GetUserApiKeys(services.RootUserId)
+	assert.NoError(t, err)
+	assert.Len(t, apiKeys, 1)
+}
+
+func TestBootstrapRootSetupToken(t *testing.T) {
+	store := newTestSQLiteStorage(t)
+	defer store.Close()
+	authService := services.NewAuthService(store)
+
+	// Invalid options are rejected before the root user is created
+	_, err := authService.BootstrapRootSetupToken(models.SetupTokenOptions{MaxUses: services.MaxSetupTokenUses + 1})
+	assert.ErrorIs(t, err, apperrors.ErrInvalidMaxUses)
+	_, err = store.GetUserById(services.RootUserId)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	setupToken, err := authService.BootstrapRootSetupToken(models.SetupTokenOptions{Long: true})
+	assert.NoError(t, err)
+	assert.Equal(t, services.RootUserId, setupToken.User)
+
+	apiKey, _, err := authService.ExchangeSetupToken(setupToken.Token, "Admin")
+	assert.NoError(t, err)
+	assert.Equal(t, services.RootUserId, apiKey.User)
+}
+
+func TestBootstrapRefusedWithSeededRoot(t *testing.T) {
+	authService := services.NewAuthService(storage.NewTestStorage(nil))
+
+	_, _, err := authService.BootstrapRootApiKey("Bootstrap")
+	assert.ErrorIs(t, err, apperrors.ErrAlreadyBootstrapped)
+}
+
+func TestBootstrapRetryAfterCredentialFailure(t *testing.T) {
+	dbPath := t.TempDir() + "/bootstrap.db"
+	store := storage.NewSQLiteStorage()
+	if err := store.Initialize(dbPath); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer store.Close()
+	authService := services.NewAuthService(store)
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for _, table := range []string{"api_key", "setup_token"} {
+		// Make storing the credential fail after the root user was created
+		_, err := db.Exec(`CREATE TRIGGER fail_credential BEFORE INSERT ON ` + table + ` BEGIN SELECT RAISE(FAIL, 'disk full'); END`)
+		if err != nil {
+			t.Fatalf("failed to create trigger: %v", err)
+		}
+		if table == "api_key" {
+			_, _, err = authService.BootstrapRootApiKey("Bootstrap")
+		} else {
+			_, err = authService.BootstrapRootSetupToken(models.SetupTokenOptions{})
+		}
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, apperrors.ErrAlreadyBootstrapped)
+
+		// Nothing is left behind
+		_, err = store.GetUserById(services.RootUserId)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		events, err := store.LoadEvents()
+		assert.NoError(t, err)
+		assert.Empty(t, events)
+
+		if _, err := db.Exec(`DROP TRIGGER fail_credential`); err != nil {
+			t.Fatalf("failed to drop trigger: %v", err)
+		}
+	}
+
+	// A retry succeeds once the credential can be stored
+	_, plainKey, err := authService.BootstrapRootApiKey("Bootstrap")
+	assert.NoError(t, err)
+	userID, err := authService.ValidateApiKey(plainKey)
+	assert.NoError(t, err)
+	assert.Equal(t, services.RootUserId, userID)
+}
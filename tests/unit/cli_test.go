@@ -0,0 +1,120 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-sync/src/cli"
+	"simple-sync/src/models"
+	"simple-sync/src/services"
+	"simple-sync/src/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestApp creates a CLI app operating on the given storage
+func newTestApp(store storage.Storage) (*cli.App, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	return &cli.App{
+		Stdout:       stdout,
+		Stderr:       stderr,
+		OpenStorage:  func() storage.Storage { return store },
+		PollInterval: 10 * time.Millisecond,
+	}, stdout, stderr
+}
+
+func TestCliUsage(t *testing.T) {
+	app, _, stderr := newTestApp(storage.NewTestStorage(nil))
+
+	assert.Equal(t, 0, app.Run(context.Background(), []string{"help"}))
+	assert.Contains(t, stderr.String(), "user add")
+
+	assert.Equal(t, 2, app.Run(context.Background(), []string{"user", "remove"}))
+	assert.Contains(t, stderr.String(), "Unknown command: user remove")
+
+	// Missing arguments print the usage of the command
+	assert.Equal(t, 2, app.Run(context.Background(), []string{"acl", "check", "alice"}))
+	assert.Contains(t, stderr.String(), "Usage: simple-sync acl check")
+}
+
+func TestCliDirectCommands(t *testing.T) {
+	store := storage.NewTestStorage(nil)
+	app, stdout, stderr := newTestApp(store)
+	run := func(args ...string) int {
+		stdout.Reset()
+		stderr.Reset()
+		return app.Run(context.Background(), args)
+	}
+
+	assert.Equal(t, 0, run("user", "add", "alice"))
+	assert.Equal(t, 1, run("user", "add", "alice"))
+	assert.Contains(t, stderr.String(), "already exists")
+
+	assert.Equal(t, 0, run("user", "list"))
+	assert.Contains(t, stdout.String(), "alice")
+	assert.Contains(t, stdout.String(), storage.TestingUserId)
+
+	// Issued keys work and can be revoked, and do not affect setup tokens
+	setupToken, err := services.NewAuthService(store).GenerateSetupToken("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, run("key", "issue", "-scopes", "events:read", "alice"))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	userID, err := services.NewAuthService(store).ValidateApiKey(lines[len(lines)-1])
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+	keys, err := store.GetUserApiKeys("alice")
+	assert.NoError(t, err)
+	if assert.Len(t, keys, 1) {
+		assert.Equal(t, []string{models.ScopeEventsRead}, keys[0].Scopes)
+		assert.Contains(t, stdout.String(), keys[0].UUID)
+	}
+	assert.Equal(t, 1, run("key", "issue", "-scopes", "events:delete", "alice"))
+	assert.Equal(t, 1, run("key", "issue", "nobody"))
+	_, _, err = services.NewAuthService(store).ExchangeSetupToken(setupToken.Token, "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, run("acl", "add", "allow", "alice", "project.*", "*"))
+	assert.Equal(t, 1, run("acl", "add", "maybe", "alice", "project.*", "*"))
+	assert.Equal(t, 0, run("acl", "list", "-user", "alice"))
+	assert.Contains(t, stdout.String(), "project.*")
+	assert.Equal(t, 0, run("acl", "check", "alice", "project.alpha", "edit"))
+	assert.True(t, strings.HasPrefix(stdout.String(), "allowed"))
+
+	// Changes are recorded as internal events authored by the root user
+	assert.Equal(t, 0, run("events", "export", "-item", ".user.alice"))
+	assert.Contains(t, stdout.String(), `"action":".user.create"`)
+	assert.Contains(t, stdout.String(), `"action":".user.exchangeToken"`)
+	assert.Equal(t, 0, run("events", "export", "-action", ".acl.addRule"))
+	assert.Contains(t, stdout.String(), `"user":".root"`)
+
+	keyUuid := keys[0].UUID
+	assert.Equal(t, 0, run("key", "revoke", keyUuid))
+	_, err = store.GetApiKeyByUuid(keyUuid)
+	assert.ErrorIs(t, err, storage.ErrApiKeyNotFound)
+}
+
+func TestCliEventsTail(t *testing.T) {
+	store := storage.NewTestStorage(nil)
+	app, stdout, _ := newTestApp(store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- app.Run(ctx, []string{"events", "tail", "-item", "tail.*"}) }()
+
+	// Only events added after the tail started are printed
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, store.AddEvents([]models.Event{
+		*models.NewEvent(storage.TestingUserId, "tail.one", "edit", "{}"),
+		*models.NewEvent(storage.TestingUserId, "other", "edit", "{}"),
+	}))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	assert.Equal(t, 0, <-done)
+	assert.Contains(t, stdout.String(), "tail.one")
+	assert.NotContains(t, stdout.String(), `"item":"other"`)
+	assert.NotContains(t, stdout.String(), ".acl")
+}
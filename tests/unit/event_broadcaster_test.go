@@ -0,0 +1,52 @@
+package unit
+
+import (
+	"testing"
+
+	"simple-sync/src/models"
+	"simple-sync/src/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBroadcasterPublish(t *testing.T) {
+	broadcaster := services.NewEventBroadcaster()
+	first := broadcaster.Subscribe()
+	second := broadcaster.Subscribe()
+
+	event := models.NewEvent("user1", "item1", "create", "{}")
+	broadcaster.Publish([]models.Event{*event})
+
+	assert.Equal(t, *event, <-first)
+	assert.Equal(t, *event, <-second)
+
+	// Unsubscribed channels are closed and no longer receive events
+	broadcaster.Unsubscribe(first)
+	_, ok := <-first
+	assert.False(t, ok)
+
+	broadcaster.Publish([]models.Event{*event})
+	assert.Equal(t, *event, <-second)
+}
+
+func TestEventBroadcasterDropsSlowSubscriber(t *testing.T) {
+	broadcaster := services.NewEventBroadcaster()
+	slow := broadcaster.Subscribe()
+
+	// Publish more events than the subscriber buffer can hold
+	events := make([]models.Event, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		events = append(events, *models.NewEvent("user1", "item1", "create", "{}"))
+	}
+	broadcaster.Publish(events)
+
+	// Buffered events are still delivered, then the channel is closed
+	received := 0
+	for range slow {
+		received++
+	}
+	assert.Less(t, received, len(events))
+
+	// Unsubscribing a dropped subscriber is a no-op
+	broadcaster.Unsubscribe(slow)
+}
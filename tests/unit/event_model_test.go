@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	apperrors "simple-sync/src/errors"
 	"simple-sync/src/models"
 
 	"github.com/stretchr/testify/assert"
@@ -144,3 +145,25 @@ func TestEventValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestEventTimestampMs(t *testing.T) {
+	// New and unmarshaled events take the millisecond timestamp from the UUID
+	event := models.NewEvent("user123", "item456", "create", "{}")
+	assert.Equal(t, event.UuidTimestampMs(), event.TimestampMs)
+
+	data, err := json.Marshal(event)
+	assert.NoError(t, err)
+	var unmarshaled models.Event
+	assert.NoError(t, json.Unmarshal(data, &unmarshaled))
+	assert.Equal(t, event.TimestampMs, unmarshaled.TimestampMs)
+
+	// Validation checks a given millisecond timestamp without filling it in
+	withoutMs := *event
+	withoutMs.TimestampMs = 0
+	assert.NoError(t, withoutMs.Validate())
+	assert.Zero(t, withoutMs.TimestampMs)
+
+	mismatched := *event
+	mismatched.TimestampMs++
+	assert.ErrorIs(t, mismatched.Validate(), apperrors.ErrInvalidTimestamp)
+}
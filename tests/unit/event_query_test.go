@@ -0,0 +1,98 @@
+package unit
+
+import (
+	"testing"
+
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventQueryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   models.EventQuery
+		wantErr bool
+	}{
+		{"empty query", models.EventQuery{}, false},
+		{"valid cursor", models.EventQuery{After: "0186e56d-7000-7000-8040-940f030080ad"}, false},
+		{"invalid cursor", models.EventQuery{After: "not-a-uuid"}, true},
+		{"negative limit", models.EventQuery{Limit: -1}, true},
+		{"prefix filter", models.EventQuery{Item: "task.*", User: "user.*", Action: "*"}, false},
+		{"wildcard in middle", models.EventQuery{Item: "task.*.edit"}, true},
+		{"multiple wildcards", models.EventQuery{Action: "edit**"}, true},
+		{"valid time range", models.EventQuery{From: 100, To: 200}, false},
+		{"open time range", models.EventQuery{From: 100}, false},
+		{"inverted time range", models.EventQuery{From: 200, To: 100}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMatchesPattern(t *testing.T) {
+	assert.True(t, models.MatchesPattern("*", "anything"))
+	assert.True(t, models.MatchesPattern("task.*", "task.123"))
+	assert.False(t, models.MatchesPattern("task.*", "note.123"))
+	assert.True(t, models.MatchesPattern("task.123", "task.123"))
+	assert.False(t, models.MatchesPattern("task.123", "task.1234"))
+}
+
+func TestNewEventPage(t *testing.T) {
+	events := []models.Event{
+		{UUID: "0186e56d-7000-7000-8040-940f030080a1", Seq: 1},
+		{UUID: "0186e56d-7000-7000-8040-940f030080a2", Seq: 2},
+		{UUID: "0186e56d-7000-7000-8040-940f030080a3", Seq: 3},
+	}
+
+	// The extra event only tells that there are more pages
+	page := models.NewEventPage(events, models.EventQuery{Limit: 3}, 2)
+	assert.True(t, page.HasMore)
+	assert.Len(t, page.Events, 2)
+	assert.Equal(t, events[1].UUID, page.Next)
+	assert.Equal(t, uint64(2), page.NextSeq)
+
+	page = models.NewEventPage(events, models.EventQuery{Limit: 4}, 3)
+	assert.False(t, page.HasMore)
+	assert.Len(t, page.Events, 3)
+	assert.Equal(t, events[2].UUID, page.Next)
+
+	// An empty page keeps the query's cursor
+	query := models.EventQuery{After: events[2].UUID, AfterSeq: 3, Limit: 3}
+	page = models.NewEventPage(nil, query, 2)
+	assert.False(t, page.HasMore)
+	assert.Empty(t, page.Events)
+	assert.Equal(t, query.After, page.Next)
+	assert.Equal(t, query.AfterSeq, page.NextSeq)
+}
+
+func TestQueryEventPage(t *testing.T) {
+	store := storage.NewTestStorage(nil)
+	var events []models.Event
+	for i := 0; i < 3; i++ {
+		events = append(events, *models.NewEvent("user-1", "page.item", "edit", "{}"))
+	}
+	assert.NoError(t, store.AddEvents(events))
+
+	// The limit is the page size; the extra event is only loaded internally
+	query := models.EventQuery{Item: "page.item"}
+	page, err := storage.QueryEventPage(store, query, 2)
+	assert.NoError(t, err)
+	assert.True(t, page.HasMore)
+	assert.Len(t, page.Events, 2)
+
+	query.After = page.Next
+	page, err = storage.QueryEventPage(store, query, 2)
+	assert.NoError(t, err)
+	assert.False(t, page.HasMore)
+	assert.Equal(t, []models.Event{events[2]}, page.Events)
+}
@@ -7,6 +7,7 @@ import (
 	"simple-sync/src/models"
 	"simple-sync/src/storage"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -68,3 +69,270 @@ func TestLoadEventsEmpty(t *testing.T) {
 	}
 	assert.Equal(t, 0, len(events))
 }
+
+func TestQueryEventsAfterCursor(t *testing.T) {
+	s := storage.NewSQLiteStorage()
+	if err := s.Initialize(":memory:"); err != nil {
+		t.Fatalf("failed to initialize in-memory sqlite: %v", err)
+	}
+	defer s.Close()
+
+	e1 := models.NewEvent("user1", "item1", "act1", "payload1")
+	e2 := models.NewEvent("user1", "item1", "act2", "payload2")
+	e3 := models.NewEvent("user1", "item1", "act3", "payload3")
+	if err := s.AddEvents([]models.Event{*e3, *e1, *e2}); err != nil {
+		t.Fatalf("AddEvents failed: %v", err)
+	}
+
+	// Without a cursor, events come back in the order they were stored
+	events, err := s.QueryEvents(models.EventQuery{})
+	if err != nil {
+		t.Fatalf("QueryEvents failed: %v", err)
+	}
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, e3.UUID, events[0].UUID)
+	assert.Equal(t, e2.UUID, events[2].UUID)
+	assert.Equal(t, []uint64{1, 2, 3}, []uint64{events[0].Seq, events[1].Seq, events[2].Seq})
+
+	// Only events stored after the cursor, limited
+	events, err = s.QueryEvents(models.EventQuery{After: e3.UUID, Limit: 1})
+	if err != nil {
+		t.Fatalf("QueryEvents failed: %v", err)
+	}
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, e1.UUID, events[0].UUID)
+
+	// The sequence number of an event works as a cursor too
+	events, err = s.QueryEvents(models.EventQuery{AfterSeq: 2})
+	if err != nil {
+		t.Fatalf("QueryEvents failed: %v", err)
+	}
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, e2.UUID, events[0].UUID)
+
+	// Cursor at the newest event returns nothing
+	events, err = s.QueryEvents(models.EventQuery{After: e2.UUID})
+	if err != nil {
+		t.Fatalf("QueryEvents failed: %v", err)
+	}
+	assert.Equal(t, 0, len(events))
+}
+
+func TestQueryEventsInvalidCursor(t *testing.T) {
+	s := storage.NewSQLiteStorage()
+	if err := s.Initialize(":memory:"); err != nil {
+		t.Fatalf("failed to initialize in-memory sqlite: %v", err)
+	}
+	defer s.Close()
+
+	_, err := s.QueryEvents(models.EventQuery{After: "not-a-uuid"})
+	assert.Error(t, err)
+}
+
+func TestTestStorageQueryEventsAfterCursor(t *testing.T) {
+	s := storage.NewTestStorage(nil)
+
+	e1 := models.NewEvent("user1", "item1", "act1", "payload1")
+	e2 := models.NewEvent("user1", "item1", "act2", "payload2")
+	e3 := models.NewEvent("user1", "item1", "act3", "payload3")
+	if err := s.AddEvents([]models.Event{*e3, *e1, *e2}); err != nil {
+		t.Fatalf("AddEvents failed: %v", err)
+	}
+
+	events, err := s.QueryEvents(models.EventQuery{After: e1.UUID, Limit: 1})
+	if err != nil {
+		t.Fatalf("QueryEvents failed: %v", err)
+	}
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, e2.UUID, events[0].UUID)
+}
+
+// newEventAt creates a valid event whose UUIDv7 embeds the given unix timestamp
+func newEventAt(timestamp int64, user, item, action string) models.Event {
+	id, _ := uuid.NewV7()
+	ms := uint64(timestamp) * 1000
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	return models.Event{
+		UUID:      id.String(),
+		Timestamp: uint64(timestamp),
+		User:      user,
+		Item:      item,
+		Action:    action,
+		Payload:   "{}",
+	}
+}
+
+func filteredEventsFixture() []models.Event {
+	return []models.Event{
+		newEventAt(1700000000, "user.42", "task.1", "create"),
+		newEventAt(1700000100, "user.42", "task.2", "edit.title"),
+		newEventAt(1700000200, "user.7", "task.1", "edit.title"),
+		newEventAt(1700000300, "user.42", "note.1", "create"),
+		newEventAt(1700000400, "user.42", "task?1", "create"),
+	}
+}
+
+func TestQueryEventsFilters(t *testing.T) {
+	sqliteStore := storage.NewSQLiteStorage()
+	if err := sqliteStore.Initialize(":memory:"); err != nil {
+		t.Fatalf("failed to initialize in-memory sqlite: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	stores := map[string]storage.Storage{
+		"sqlite": sqliteStore,
+		"test":   storage.NewTestStorage(nil),
+	}
+
+	fixture := filteredEventsFixture()
+	tests := []struct {
+		name     string
+		query    models.EventQuery
+		expected []int
+	}{
+		{"no filters", models.EventQuery{}, []int{0, 1, 2, 3, 4}},
+		{"item prefix", models.EventQuery{Item: "task.*"}, []int{0, 1, 2}},
+		{"item exact", models.EventQuery{Item: "task.1"}, []int{0, 2}},
+		{"item glob characters are literal", models.EventQuery{Item: "task?*"}, []int{4}},
+		{"user", models.EventQuery{User: "user.42"}, []int{0, 1, 3, 4}},
+		{"action prefix", models.EventQuery{Action: "edit.*"}, []int{1, 2}},
+		{"wildcard", models.EventQuery{Item: "*"}, []int{0, 1, 2, 3, 4}},
+		{"time range", models.EventQuery{From: 1700000100, To: 1700000300}, []int{1, 2, 3}},
+		{"combined", models.EventQuery{Item: "task.*", User: "user.42", From: 1700000050, To: 1700000250}, []int{1}},
+		{"millisecond time range", models.EventQuery{FromMs: 1700000100000, ToMs: 1700000299999}, []int{1, 2}},
+		{"after cursor", models.EventQuery{After: fixture[1].UUID, Item: "task.*"}, []int{2}},
+	}
+
+	for name, store := range stores {
+		if err := store.AddEvents(fixture); err != nil {
+			t.Fatalf("%s: AddEvents failed: %v", name, err)
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				events, err := store.QueryEvents(tt.query)
+				assert.NoError(t, err)
+
+				var got []string
+				for _, e := range events {
+					got = append(got, e.UUID)
+				}
+				var expected []string
+				for _, i := range tt.expected {
+					expected = append(expected, fixture[i].UUID)
+				}
+				assert.Equal(t, expected, got)
+			})
+		}
+	}
+}
+
+func TestSubmitEvents(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T) storage.Storage{
+		"memory": func(t *testing.T) storage.Storage { return storage.NewTestStorage(nil) },
+		"sqlite": func(t *testing.T) storage.Storage {
+			s := newTestSQLiteStorage(t)
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			stored := models.NewEvent("user1", "item1", "act1", "payload1")
+			if err := store.AddEvents([]models.Event{*stored}); err != nil {
+				t.Fatalf("AddEvents failed: %v", err)
+			}
+			if err := store.AddUser(&models.User{Id: "user-1", CreatedAt: time.Now()}); err != nil {
+				t.Fatalf("AddUser failed: %v", err)
+			}
+			before, _ := store.LoadEvents()
+
+			// A retry of the stored event is a duplicate, a changed one a conflict
+			conflicting := *stored
+			conflicting.Payload = "changed"
+			fresh := models.NewEvent("user1", "item2", "act1", "")
+			existingUser := models.NewEvent(".root", ".user.user-1", ".user.create", "{}")
+			newUser := models.NewEvent(".root", ".user.user-2", ".user.create", "{}")
+			events := []models.Event{*stored, conflicting, *fresh, {UUID: "invalid"}, *newUser, *newUser, *existingUser}
+
+			// Atomic submissions fail at the first rejection and store nothing
+			_, err := store.SubmitEvents(events, true)
+			assert.ErrorIs(t, err, storage.ErrDuplicateKey)
+			after, _ := store.LoadEvents()
+			assert.Len(t, after, len(before))
+
+			results, err := store.SubmitEvents(events, false)
+			assert.NoError(t, err)
+			statuses := make([]string, len(results))
+			for i, result := range results {
+				assert.Equal(t, events[i].UUID, result.UUID)
+				statuses[i] = result.Status
+			}
+			assert.Equal(t, []string{
+				models.EventStatusDuplicate,
+				models.EventStatusRejected,
+				models.EventStatusAccepted,
+				models.EventStatusRejected,
+				models.EventStatusAccepted,
+				models.EventStatusDuplicate,
+				models.EventStatusRejected,
+			}, statuses)
+			assert.Equal(t, storage.ErrDuplicateKey.Error(), results[1].Error)
+			assert.Equal(t, storage.ErrUserExists.Error(), results[6].Error)
+			assert.ErrorIs(t, results[1].Err, storage.ErrDuplicateKey)
+			assert.ErrorIs(t, results[6].Err, storage.ErrUserExists)
+
+			after, _ = store.LoadEvents()
+			assert.Len(t, after, len(before)+2)
+			_, err = store.GetUserById("user-2")
+			assert.NoError(t, err)
+
+			// Retrying the whole batch atomically succeeds once it was stored
+			results, err = store.SubmitEvents([]models.Event{*stored, *fresh, *newUser}, true)
+			assert.NoError(t, err)
+			for _, result := range results {
+				assert.Equal(t, models.EventStatusDuplicate, result.Status)
+			}
+		})
+	}
+}
+
+func TestLoadEventsInStoredOrder(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T) storage.Storage{
+		"memory": func(t *testing.T) storage.Storage { return storage.NewTestStorage(nil) },
+		"sqlite": func(t *testing.T) storage.Storage {
+			s := newTestSQLiteStorage(t)
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+
+			// Events within the same millisecond, whose UUIDs are in random order
+			now := time.Now().Unix()
+			for _, action := range []string{"act1", "act2", "act3"} {
+				batch := []models.Event{newEventAt(now, "user1", "item1", action)}
+				if err := store.AddEvents(batch); err != nil {
+					t.Fatalf("AddEvents failed: %v", err)
+				}
+				assert.NotZero(t, batch[0].Seq)
+			}
+
+			events, err := store.LoadEvents()
+			if err != nil {
+				t.Fatalf("LoadEvents failed: %v", err)
+			}
+			var actions []string
+			for i, e := range events {
+				actions = append(actions, e.Action)
+				if i > 0 {
+					assert.Greater(t, e.Seq, events[i-1].Seq)
+				}
+			}
+			assert.Equal(t, []string{"act1", "act2", "act3"}, actions)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package unit
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"simple-sync/src/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeThrottleClientLockout(t *testing.T) {
+	limits := services.ThrottleLimits{
+		FreeFailures: 2,
+		BaseLockout:  10 * time.Millisecond,
+		MaxLockout:   40 * time.Millisecond,
+		ResetAfter:   time.Hour,
+	}
+	unlimited := services.ThrottleLimits{FreeFailures: 1000, ResetAfter: time.Hour}
+	throttle := services.NewExchangeThrottle(limits, unlimited)
+
+	// Free failures do not lock the client out
+	for i := 1; i <= 2; i++ {
+		failures, lockout := throttle.Failure("10.0.0.1")
+		assert.Equal(t, i, failures)
+		assert.Zero(t, lockout)
+	}
+	_, ok := throttle.Allow("10.0.0.1")
+	assert.True(t, ok)
+
+	// Further failures double the lockout up to the maximum
+	for _, expected := range []time.Duration{10, 20, 40, 40} {
+		_, lockout := throttle.Failure("10.0.0.1")
+		assert.Equal(t, expected*time.Millisecond, lockout)
+	}
+	wait, ok := throttle.Allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.Greater(t, wait, time.Duration(0))
+
+	// Other clients are not affected
+	_, ok = throttle.Allow("10.0.0.2")
+	assert.True(t, ok)
+	throttle.Release("10.0.0.2")
+
+	// The lockout ends, and a success forgets the failures
+	time.Sleep(50 * time.Millisecond)
+	_, ok = throttle.Allow("10.0.0.1")
+	assert.True(t, ok)
+	throttle.Success("10.0.0.1")
+	failures, lockout := throttle.Failure("10.0.0.1")
+	assert.Equal(t, 1, failures)
+	assert.Zero(t, lockout)
+}
+
+func TestExchangeThrottleGlobalLockout(t *testing.T) {
+	unlimited := services.ThrottleLimits{FreeFailures: 1000, ResetAfter: time.Hour}
+	global := services.ThrottleLimits{
+		FreeFailures: 3,
+		BaseLockout:  time.Minute,
+		MaxLockout:   time.Minute,
+		ResetAfter:   time.Hour,
+	}
+	throttle := services.NewExchangeThrottle(unlimited, global)
+
+	// Failures spread over many clients lock out everyone
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		_, lockout := throttle.Failure(ip)
+		assert.Zero(t, lockout)
+	}
+	_, lockout := throttle.Failure("10.0.0.4")
+	assert.Equal(t, time.Minute, lockout)
+
+	_, ok := throttle.Allow("10.0.0.5")
+	assert.False(t, ok)
+}
+
+func TestExchangeThrottleConcurrentAttempts(t *testing.T) {
+	limits := services.ThrottleLimits{
+		FreeFailures: 2,
+		BaseLockout:  time.Minute,
+		MaxLockout:   time.Minute,
+		ResetAfter:   time.Hour,
+	}
+	unlimited := services.ThrottleLimits{FreeFailures: 1000, ResetAfter: time.Hour}
+	throttle := services.NewExchangeThrottle(limits, unlimited)
+
+	// Concurrent attempts only get the free failures between them
+	var allowed sync.WaitGroup
+	var mutex sync.Mutex
+	count := 0
+	for i := 0; i < 20; i++ {
+		allowed.Add(1)
+		go func() {
+			defer allowed.Done()
+			if _, ok := throttle.Allow("10.0.0.1"); ok {
+				mutex.Lock()
+				count++
+				mutex.Unlock()
+			}
+		}()
+	}
+	allowed.Wait()
+	assert.Equal(t, 2, count)
+
+	// Attempts that end without failing give their reservation back
+	throttle.Release("10.0.0.1")
+	_, ok := throttle.Allow("10.0.0.1")
+	assert.True(t, ok)
+
+	// Once the free failures are used up, one attempt runs at a time
+	throttle.Failure("10.0.0.1")
+	_, lockout := throttle.Failure("10.0.0.1")
+	assert.Zero(t, lockout)
+	_, ok = throttle.Allow("10.0.0.1")
+	assert.True(t, ok)
+	_, ok = throttle.Allow("10.0.0.1")
+	assert.False(t, ok)
+
+	// And its failure locks the client out
+	_, lockout = throttle.Failure("10.0.0.1")
+	assert.Equal(t, time.Minute, lockout)
+	_, ok = throttle.Allow("10.0.0.1")
+	assert.False(t, ok)
+}
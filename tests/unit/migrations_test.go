@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"simple-sync/src/storage"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -50,3 +51,237 @@ func TestApplyMigrationsCreatesTablesAndSetsVersion(t *testing.T) {
 		t.Fatalf("expected user_version %d after second run, got %d", storage.DesiredSchemaVersion, v)
 	}
 }
+
+// createVersion1Schema creates the tables of the original schema and marks
+// the database as version 1, so later migrations can be tested against it
+func createVersion1Schema(t *testing.T, db *sql.DB) {
+	stmts := []string{
+		`CREATE TABLE user (
+			id TEXT PRIMARY KEY,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE event (
+			uuid TEXT PRIMARY KEY,
+			timestamp INTEGER NOT NULL,
+			user TEXT NOT NULL,
+			item TEXT NOT NULL,
+			action TEXT NOT NULL,
+			payload TEXT
+		)`,
+		`CREATE TABLE api_key (
+			uuid TEXT PRIMARY KEY,
+			user TEXT NOT NULL,
+			key_hash TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			last_used_at DATETIME,
+			description TEXT,
+			FOREIGN KEY(user) REFERENCES user(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE setup_token (
+			token TEXT PRIMARY KEY,
+			user TEXT NOT NULL,
+			expires_at DATETIME,
+			used_at DATETIME,
+			FOREIGN KEY(user) REFERENCES user(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE acl_rule (
+			user TEXT NOT NULL,
+			item TEXT NOT NULL,
+			action TEXT NOT NULL,
+			type TEXT NOT NULL,
+			PRIMARY KEY (user, item, action, type)
+		)`,
+		`PRAGMA user_version = 1`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to create version 1 schema: %v", err)
+		}
+	}
+}
+
+func TestApplyMigrationsBackfillsAclRules(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open in-memory sqlite: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// A version 1 database holding ACL events but no materialised rules
+	createVersion1Schema(t, db)
+	_, err = db.Exec(`INSERT INTO event (uuid, timestamp, user, item, action, payload) VALUES
+		('0199c74f-c696-78f8-833a-82f8cf1f1941', 1759985518, '.root', '.acl', '.acl.addRule', '{"user":"alice","item":"doc","action":"read","type":"allow"}'),
+		('0199c74f-c696-78f8-833a-82f8cf1f1942', 1759985519, '.root', '.acl', '.acl.addRule', 'not json'),
+		('0199c74f-c696-78f8-833a-82f8cf1f1943', 1759985520, 'alice', 'doc', 'read', '{"user":"bob","item":"doc","action":"read","type":"allow"}')`)
+	if err != nil {
+		t.Fatalf("failed to insert events: %v", err)
+	}
+
+	if err := storage.ApplyMigrations(db); err != nil {
+		t.Fatalf("ApplyMigrations failed: %v", err)
+	}
+
+	var user, item, action, ruleType, eventUuid, eventUser string
+	var eventTimestamp int64
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM acl_rule").Scan(&count); err != nil {
+		t.Fatalf("failed to count ACL rules: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 backfilled ACL rule, got %d", count)
+	}
+	row := db.QueryRow("SELECT user, item, action, type, event_uuid, event_user, event_timestamp FROM acl_rule")
+	if err := row.Scan(&user, &item, &action, &ruleType, &eventUuid, &eventUser, &eventTimestamp); err != nil {
+		t.Fatalf("failed to read ACL rule: %v", err)
+	}
+	if user != "alice" || item != "doc" || action != "read" || ruleType != "allow" {
+		t.Fatalf("unexpected backfilled rule: %s %s %s %s", user, item, action, ruleType)
+	}
+	if eventUuid != "0199c74f-c696-78f8-833a-82f8cf1f1941" || eventUser != ".root" || eventTimestamp != 1759985518 {
+		t.Fatalf("unexpected backfilled rule event: %s %s %d", eventUuid, eventUser, eventTimestamp)
+	}
+}
+
+func TestApplyMigrationsBackfillsSetupTokenUses(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open in-memory sqlite: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Unused tokens were stored with a zero used_at
+	createVersion1Schema(t, db)
+	expiresAt := time.Now().Add(time.Hour)
+	if _, err := db.Exec(`INSERT INTO user (id, created_at) VALUES ('user-m', ?)`, time.Now()); err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO setup_token (token, user, expires_at, used_at) VALUES ('USED-0001', 'user-m', ?, ?), ('FREE-0001', 'user-m', ?, ?)`,
+		expiresAt, time.Now(), expiresAt, time.Time{})
+	if err != nil {
+		t.Fatalf("failed to insert setup tokens: %v", err)
+	}
+
+	if err := storage.ApplyMigrations(db); err != nil {
+		t.Fatalf("ApplyMigrations failed: %v", err)
+	}
+
+	for token, expected := range map[string]int{"USED-0001": 1, "FREE-0001": 0} {
+		var maxUses, useCount int
+		var invitation bool
+		if err := db.QueryRow(`SELECT max_uses, use_count, invitation FROM setup_token WHERE token = ?`, token).Scan(&maxUses, &useCount, &invitation); err != nil {
+			t.Fatalf("failed to read setup token %s: %v", token, err)
+		}
+		if maxUses != 1 || useCount != expected {
+			t.Fatalf("expected %s to have max_uses 1 and use_count %d, got %d and %d", token, expected, maxUses, useCount)
+		}
+		if invitation {
+			t.Fatalf("expected %s not to be an invitation", token)
+		}
+	}
+}
+
+func TestApplyMigrationsBackfillsEventSeq(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open in-memory sqlite: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Events within the same second keep the order they were inserted in
+	createVersion1Schema(t, db)
+	_, err = db.Exec(`INSERT INTO event (uuid, timestamp, user, item, action, payload) VALUES
+		('0199c74f-c696-78f8-833a-82f8cf1f1943', 1759985519, 'alice', 'doc', 'update', '{}'),
+		('0199c74f-c696-78f8-833a-82f8cf1f1942', 1759985518, 'alice', 'doc', 'update', '{}'),
+		('0199c74f-c696-78f8-833a-82f8cf1f1941', 1759985518, 'alice', 'doc', 'create', '{}')`)
+	if err != nil {
+		t.Fatalf("failed to insert events: %v", err)
+	}
+
+	if err := storage.ApplyMigrations(db); err != nil {
+		t.Fatalf("ApplyMigrations failed: %v", err)
+	}
+
+	rows, err := db.Query("SELECT uuid, seq FROM event ORDER BY seq")
+	if err != nil {
+		t.Fatalf("failed to read events: %v", err)
+	}
+	defer rows.Close()
+	var order []string
+	for rows.Next() {
+		var uuid string
+		var seq int
+		if err := rows.Scan(&uuid, &seq); err != nil {
+			t.Fatalf("failed to scan event: %v", err)
+		}
+		if seq != len(order)+1 {
+			t.Fatalf("expected seq %d for %s, got %d", len(order)+1, uuid, seq)
+		}
+		order = append(order, uuid[len(uuid)-1:])
+	}
+	if len(order) != 3 || order[0] != "2" || order[1] != "1" || order[2] != "3" {
+		t.Fatalf("unexpected event order %v", order)
+	}
+
+	// New events continue the sequence
+	result, err := db.Exec(`INSERT INTO event (uuid, timestamp, user, item, action, payload) VALUES
+		('0199c74f-c696-78f8-833a-82f8cf1f1944', 1759985519, 'alice', 'doc', 'delete', '{}')`)
+	if err != nil {
+		t.Fatalf("failed to insert event: %v", err)
+	}
+	if seq, _ := result.LastInsertId(); seq != 4 {
+		t.Fatalf("expected seq 4 for a new event, got %d", seq)
+	}
+
+	// Sequence numbers are not reused once the last event is gone
+	if _, err := db.Exec(`DELETE FROM event WHERE seq = 4`); err != nil {
+		t.Fatalf("failed to delete event: %v", err)
+	}
+	result, err = db.Exec(`INSERT INTO event (uuid, timestamp, user, item, action, payload) VALUES
+		('0199c74f-c696-78f8-833a-82f8cf1f1945', 1759985519, 'alice', 'doc', 'create', '{}')`)
+	if err != nil {
+		t.Fatalf("failed to insert event: %v", err)
+	}
+	if seq, _ := result.LastInsertId(); seq != 5 {
+		t.Fatalf("expected seq 5 for a new event, got %d", seq)
+	}
+}
+
+func TestApplyMigrationsBackfillsEventTimestampMs(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open in-memory sqlite: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// The second event's timestamp doesn't match its UUID, so it keeps the
+	// second precision timestamp
+	createVersion1Schema(t, db)
+	_, err = db.Exec(`INSERT INTO event (uuid, timestamp, user, item, action, payload) VALUES
+		('0199c74f-c696-78f8-833a-82f8cf1f1941', 1759985518, 'alice', 'doc', 'create', '{}'),
+		('0199c74f-c696-78f8-833a-82f8cf1f1942', 1759985600, 'alice', 'doc', 'update', '{}')`)
+	if err != nil {
+		t.Fatalf("failed to insert events: %v", err)
+	}
+
+	if err := storage.ApplyMigrations(db); err != nil {
+		t.Fatalf("ApplyMigrations failed: %v", err)
+	}
+
+	expected := map[string]int64{
+		"0199c74f-c696-78f8-833a-82f8cf1f1941": 1759985518230,
+		"0199c74f-c696-78f8-833a-82f8cf1f1942": 1759985600000,
+	}
+	for uuid, want := range expected {
+		var got int64
+		if err := db.QueryRow("SELECT timestamp_ms FROM event WHERE uuid = ?", uuid).Scan(&got); err != nil {
+			t.Fatalf("failed to read event %s: %v", uuid, err)
+		}
+		if got != want {
+			t.Fatalf("expected timestamp_ms %d for %s, got %d", want, uuid, got)
+		}
+	}
+}
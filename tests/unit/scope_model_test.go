@@ -0,0 +1,43 @@
+package unit
+
+import (
+	"testing"
+
+	apperrors "simple-sync/src/errors"
+	"simple-sync/src/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScopes(t *testing.T) {
+	assert.NoError(t, models.ValidateScopes(nil))
+	assert.NoError(t, models.ValidateScopes([]string{models.ScopeEventsRead, models.ScopeUserAdmin}))
+	assert.ErrorIs(t, models.ValidateScopes([]string{models.ScopeEventsRead, "events:delete"}), apperrors.ErrInvalidScope)
+}
+
+func TestHasScope(t *testing.T) {
+	// No scopes means unrestricted
+	assert.True(t, models.HasScope(nil, models.ScopeAclWrite))
+
+	scopes := []string{models.ScopeEventsRead}
+	assert.True(t, models.HasScope(scopes, models.ScopeEventsRead))
+	assert.False(t, models.HasScope(scopes, models.ScopeEventsWrite))
+}
+
+func TestScopesSubset(t *testing.T) {
+	readWrite := []string{models.ScopeEventsRead, models.ScopeEventsWrite}
+
+	assert.True(t, models.ScopesSubset(nil, nil))
+	assert.True(t, models.ScopesSubset(readWrite, nil))
+	assert.True(t, models.ScopesSubset([]string{models.ScopeEventsRead}, readWrite))
+	assert.False(t, models.ScopesSubset([]string{models.ScopeAclRead}, readWrite))
+	// A scoped key cannot grant an unrestricted one
+	assert.False(t, models.ScopesSubset(nil, readWrite))
+}
+
+func TestFormatAndParseScopes(t *testing.T) {
+	scopes := []string{models.ScopeEventsRead, models.ScopeAclRead}
+	assert.Equal(t, "events:read acl:read", models.FormatScopes(scopes))
+	assert.Equal(t, scopes, models.ParseScopes("events:read acl:read"))
+	assert.Empty(t, models.ParseScopes(""))
+}
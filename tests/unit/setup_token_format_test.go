@@ -0,0 +1,43 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"simple-sync/src/models"
+	"simple-sync/src/storage"
+	"simple-sync/src/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateTokenFormat(t *testing.T) {
+	token, err := utils.GenerateToken()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[A-Z0-9]{4}-[A-Z0-9]{4}$`, token)
+
+	longToken, err := utils.GenerateLongToken()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[A-Z0-9]{4}(-[A-Z0-9]{4}){5}$`, longToken)
+
+	// Both formats are valid setup tokens
+	for _, token := range []string{token, longToken} {
+		setupToken := models.NewSetupToken(token, storage.TestingUserId, time.Now().Add(time.Hour))
+		assert.NoError(t, setupToken.Validate())
+	}
+}
+
+func TestGenerateTokenUsesWholeCharset(t *testing.T) {
+	// Every character should appear in a few thousand tokens
+	seen := make(map[rune]int)
+	for range 500 {
+		token, err := utils.GenerateLongToken()
+		assert.NoError(t, err)
+		for _, c := range token {
+			if c != '-' {
+				seen[c]++
+			}
+		}
+	}
+	assert.Len(t, seen, 36)
+}
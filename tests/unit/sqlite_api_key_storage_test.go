@@ -1,6 +1,7 @@
 package unit
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -86,3 +87,193 @@ func TestGetAllApiKeysAndUpdateInvalidate(t *testing.T) {
 		}
 	}
 }
+
+func TestGetApiKeyByKeyIdAndLegacyKeys(t *testing.T) {
+	s := storage.NewSQLiteStorage()
+	if err := s.Initialize(":memory:"); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.AddUser(&models.User{Id: "user-z", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+
+	legacy := models.NewApiKey("user-z", "hash-legacy", "legacy")
+	withId := models.NewApiKey("user-z", "hash-id", "with id")
+	withId.KeyId = "0123456789abcdef"
+	for _, k := range []*models.ApiKey{legacy, withId} {
+		if err := s.AddApiKey(k); err != nil {
+			t.Fatalf("AddApiKey failed: %v", err)
+		}
+	}
+
+	got, err := s.GetApiKeyByKeyId("0123456789abcdef")
+	if err != nil {
+		t.Fatalf("GetApiKeyByKeyId failed: %v", err)
+	}
+	if got.UUID != withId.UUID || got.KeyId != withId.KeyId {
+		t.Fatalf("expected key %s with ID %s, got %s with ID %s", withId.UUID, withId.KeyId, got.UUID, got.KeyId)
+	}
+
+	if _, err := s.GetApiKeyByKeyId("fedcba9876543210"); err != storage.ErrApiKeyNotFound {
+		t.Fatalf("expected ErrApiKeyNotFound, got %v", err)
+	}
+
+	keys, err := s.GetLegacyApiKeys()
+	if err != nil {
+		t.Fatalf("GetLegacyApiKeys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].UUID != legacy.UUID || keys[0].KeyId != "" {
+		t.Fatalf("expected only the legacy key, got %v", keys)
+	}
+
+	// Key IDs are unique
+	duplicate := models.NewApiKey("user-z", "hash-other", "duplicate")
+	duplicate.KeyId = withId.KeyId
+	if err := s.AddApiKey(duplicate); err != storage.ErrDuplicateKey {
+		t.Fatalf("expected ErrDuplicateKey, got %v", err)
+	}
+}
+
+func TestApiKeyScopesRoundTrip(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+	defer s.Close()
+
+	if err := s.AddUser(&models.User{Id: "user-s", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+
+	scoped := models.NewApiKey("user-s", "hash-scoped", "scoped")
+	scoped.Scopes = []string{models.ScopeEventsRead, models.ScopeAclRead}
+	unrestricted := models.NewApiKey("user-s", "hash-unrestricted", "unrestricted")
+	if err := s.AddApiKey(scoped); err != nil {
+		t.Fatalf("AddApiKey scoped failed: %v", err)
+	}
+	if err := s.AddApiKey(unrestricted); err != nil {
+		t.Fatalf("AddApiKey unrestricted failed: %v", err)
+	}
+
+	got, err := s.GetApiKeyByHash("hash-scoped")
+	if err != nil {
+		t.Fatalf("GetApiKeyByHash failed: %v", err)
+	}
+	if models.FormatScopes(got.Scopes) != "events:read acl:read" {
+		t.Fatalf("expected scopes to round trip, got %v", got.Scopes)
+	}
+
+	got, err = s.GetApiKeyByHash("hash-unrestricted")
+	if err != nil {
+		t.Fatalf("GetApiKeyByHash failed: %v", err)
+	}
+	if len(got.Scopes) != 0 {
+		t.Fatalf("expected no scopes, got %v", got.Scopes)
+	}
+}
+
+func TestGetApiKeyByUuidAndUserApiKeys(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+	defer s.Close()
+
+	for _, id := range []string{"user-a", "user-b"} {
+		if err := s.AddUser(&models.User{Id: id, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("AddUser failed: %v", err)
+		}
+	}
+
+	first := models.NewApiKey("user-a", "hash-1", "first")
+	second := models.NewApiKey("user-a", "hash-2", "second")
+	other := models.NewApiKey("user-b", "hash-3", "other")
+	for _, k := range []*models.ApiKey{first, second, other} {
+		if err := s.AddApiKey(k); err != nil {
+			t.Fatalf("AddApiKey failed: %v", err)
+		}
+	}
+
+	got, err := s.GetApiKeyByUuid(second.UUID)
+	if err != nil {
+		t.Fatalf("GetApiKeyByUuid failed: %v", err)
+	}
+	if got.Description != "second" {
+		t.Fatalf("expected second key, got %s", got.Description)
+	}
+	if _, err := s.GetApiKeyByUuid("missing"); err != storage.ErrApiKeyNotFound {
+		t.Fatalf("expected ErrApiKeyNotFound, got %v", err)
+	}
+
+	keys, err := s.GetUserApiKeys("user-a")
+	if err != nil {
+		t.Fatalf("GetUserApiKeys failed: %v", err)
+	}
+	if len(keys) != 2 || keys[0].UUID != first.UUID || keys[1].UUID != second.UUID {
+		t.Fatalf("expected user-a keys oldest first, got %v", keys)
+	}
+}
+
+func TestExpireUserApiKeys(t *testing.T) {
+	s := storage.NewSQLiteStorage()
+	if err := s.Initialize(t.TempDir() + "/expire.db"); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer s.Close()
+	if err := s.AddUser(&models.User{Id: "user-x", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+
+	// Expiry times in another time zone are compared by instant
+	expiresAt := time.Now().Add(time.Hour)
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	earlier := expiresAt.Add(-time.Minute).In(zone)
+	later := expiresAt.Add(time.Minute).In(zone)
+	keys := map[*models.ApiKey]*time.Time{
+		models.NewApiKey("user-x", "hash-never", "never"):     nil,
+		models.NewApiKey("user-x", "hash-earlier", "earlier"): &earlier,
+		models.NewApiKey("user-x", "hash-later", "later"):     &later,
+	}
+	for key, expiry := range keys {
+		key.ExpiresAt = expiry
+		if err := s.AddApiKey(key); err != nil {
+			t.Fatalf("AddApiKey failed: %v", err)
+		}
+	}
+
+	// Concurrent writers do not make the update fail
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*50*2)
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				errs <- s.ExpireUserApiKeys("user-x", expiresAt)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				errs <- s.AddEvents([]models.Event{*models.NewEvent("user-x", "item1", "create", "{}")})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent write failed: %v", err)
+		}
+	}
+
+	for key := range keys {
+		got, err := s.GetApiKeyByHash(key.KeyHash)
+		if err != nil {
+			t.Fatalf("GetApiKeyByHash failed: %v", err)
+		}
+		want := expiresAt
+		if key.Description == "earlier" {
+			want = earlier
+		}
+		if got.ExpiresAt == nil || !got.ExpiresAt.Equal(want) {
+			t.Fatalf("key %s: expected expiry %v, got %v", key.Description, want, got.ExpiresAt)
+		}
+	}
+}
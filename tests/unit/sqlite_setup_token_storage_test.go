@@ -53,3 +53,44 @@ func TestCreateGetUpdateInvalidateSetupToken(t *testing.T) {
 		t.Fatalf("expected token to be marked used")
 	}
 }
+
+func TestMultiUseSetupToken(t *testing.T) {
+	s := storage.NewSQLiteStorage()
+	if err := s.Initialize("file::memory:?cache=shared"); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.AddUser(&models.User{Id: "user-m", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+
+	st := models.NewSetupToken("MULT-0001", "user-m", time.Now().Add(time.Hour))
+	st.MaxUses = 2
+	if err := s.AddSetupToken(st); err != nil {
+		t.Fatalf("AddSetupToken failed: %v", err)
+	}
+
+	// The token can be used twice
+	for i := 0; i < 2; i++ {
+		got, err := s.GetSetupToken("MULT-0001")
+		if err != nil {
+			t.Fatalf("GetSetupToken failed: %v", err)
+		}
+		if !got.IsValid() {
+			t.Fatalf("expected token to be valid after %d uses", i)
+		}
+		got.MarkUsed()
+		if err := s.UpdateSetupToken(got); err != nil {
+			t.Fatalf("UpdateSetupToken failed: %v", err)
+		}
+	}
+
+	got, err := s.GetSetupToken("MULT-0001")
+	if err != nil {
+		t.Fatalf("GetSetupToken failed: %v", err)
+	}
+	if got.MaxUses != 2 || got.UseCount != 2 || got.IsValid() {
+		t.Fatalf("expected token to be used up, got %d of %d uses", got.UseCount, got.MaxUses)
+	}
+}
@@ -42,3 +42,47 @@ func TestSQLiteStorage_AddUserAndGetUserById(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, storage.ErrNotFound, err)
 }
+
+func TestAddEventsUserCreate(t *testing.T) {
+	sqliteStorage := storage.NewSQLiteStorage()
+	if err := sqliteStorage.Initialize(":memory:"); err != nil {
+		t.Fatalf("failed to initialize sqlite storage: %v", err)
+	}
+	defer sqliteStorage.Close()
+
+	backends := map[string]storage.Storage{
+		"sqlite": sqliteStorage,
+		"test":   storage.NewTestStorage(nil),
+	}
+
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) {
+			create := models.NewEvent(".root", ".user.alice", ".user.create", "{}")
+			assert.NoError(t, store.AddEvents([]models.Event{*create}))
+
+			user, err := store.GetUserById("alice")
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", user.Id)
+
+			// A batch containing an existing user is rejected as a whole
+			other := models.NewEvent(".root", "item456", "create", "{}")
+			duplicate := models.NewEvent(".root", ".user.alice", ".user.create", "{}")
+			err = store.AddEvents([]models.Event{*other, *duplicate})
+			assert.Equal(t, storage.ErrUserExists, err)
+
+			events, err := store.LoadEvents()
+			assert.NoError(t, err)
+			for _, event := range events {
+				assert.NotEqual(t, other.UUID, event.UUID)
+			}
+
+			// Duplicates within a single batch are rejected too
+			bob := models.NewEvent(".root", ".user.bob", ".user.create", "{}")
+			bobAgain := models.NewEvent(".root", ".user.bob", ".user.create", "{}")
+			err = store.AddEvents([]models.Event{*bob, *bobAgain})
+			assert.Equal(t, storage.ErrUserExists, err)
+			_, err = store.GetUserById("bob")
+			assert.Equal(t, storage.ErrNotFound, err)
+		})
+	}
+}